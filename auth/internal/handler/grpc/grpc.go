@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"mmoviecom/gen"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
 	"time"
@@ -46,8 +47,9 @@ func (h *Handler) GetToken(ctx context.Context, req *gen.GetTokenRequest) (*gen.
 	h.getTokenMetrics.Calls.Inc(1)
 	username, password := req.GetUsername(), req.GetPassword()
 	if !validCredentials(username, password) {
-		h.getTokenMetrics.InvalidArgumentErrors.Inc(1)
-		return nil, status.Errorf(codes.Unauthenticated, "invalid credentials")
+		err := errs.Unauthenticated("invalid credentials")
+		h.getTokenMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
@@ -82,13 +84,15 @@ func (h *Handler) ValidateToken(ctx context.Context, req *gen.ValidateTokenReque
 		return h.secretProvider(), nil
 	})
 	if err != nil {
-		h.validateTokenMetrics.InvalidArgumentErrors.Inc(1)
-		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		err := errs.Unauthenticated(fmt.Sprintf("invalid token: %v", err))
+		h.validateTokenMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		h.validateTokenMetrics.InvalidArgumentErrors.Inc(1)
-		return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		err := errs.Unauthenticated("invalid token")
+		h.validateTokenMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	var username string
 	if v, ok := claims["username"]; ok {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"mmoviecom/rating/configs"
+	"mmoviecom/schema"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	configFile := flag.String("config", "rating/configs/defaults.yaml", "Service configuration file with the database to migrate")
+	flag.Parse()
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	mysqlCfg := cfg.DatabaseConfig.Mysql
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", mysqlCfg.User, mysqlCfg.Pass, mysqlCfg.Host, mysqlCfg.Port, mysqlCfg.Name))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	applied, err := schema.Apply(context.Background(), db)
+	for _, v := range applied {
+		fmt.Println("Applied migration", v)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date")
+	}
+}
+
+func readConfig(fileName string) (*configs.ServiceConfig, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg configs.ServiceConfig
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
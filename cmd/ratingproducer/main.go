@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"mmoviecom/rating/pkg/model"
@@ -10,11 +11,19 @@ import (
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/go-playground/validator/v10"
+	"google.golang.org/protobuf/proto"
 )
 
 var validate = validator.New()
 
 func main() {
+	format := flag.String("format", "json", "Rating event encoding format: json or proto")
+	flag.Parse()
+	contentType, err := formatContentType(*format)
+	if err != nil {
+		panic(err)
+	}
+
 	fmt.Println("Creating a Kafka producer")
 
 	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": "localhost"})
@@ -32,7 +41,7 @@ func main() {
 	}
 
 	const topic = "ratings"
-	if err := produceRatingEvents(topic, producer, ratingEvents); err != nil {
+	if err := produceRatingEvents(topic, producer, ratingEvents, contentType); err != nil {
 		panic(err)
 	}
 
@@ -55,13 +64,32 @@ func readRatingEvents(fileName string) ([]model.RatingEvent, error) {
 	return ratings, nil
 }
 
-func produceRatingEvents(topic string, producer *kafka.Producer, events []model.RatingEvent) error {
+func formatContentType(format string) (string, error) {
+	switch format {
+	case "json":
+		return model.ContentTypeJSON, nil
+	case "proto":
+		return model.ContentTypeProtobuf, nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func encodeRatingEvent(event *model.RatingEvent, contentType string) ([]byte, error) {
+	if contentType == model.ContentTypeProtobuf {
+		return proto.Marshal(model.RatingEventToProto(event))
+	}
+	return json.Marshal(event)
+}
+
+func produceRatingEvents(topic string, producer *kafka.Producer, events []model.RatingEvent, contentType string) error {
 	for _, event := range events {
 		if err := validate.Struct(event); err != nil {
 			log.Printf("rating event validation failed: %s", err.Error())
 			continue
 		}
-		encodedEvent, err := json.Marshal(event)
+		event.SchemaVersion = model.RatingEventSchemaVersion
+		encodedEvent, err := encodeRatingEvent(&event, contentType)
 		if err != nil {
 			return err
 		}
@@ -71,7 +99,10 @@ func produceRatingEvents(topic string, producer *kafka.Producer, events []model.
 				Topic:     &topic,
 				Partition: kafka.PartitionAny,
 			},
-			Value: []byte(encodedEvent),
+			Value: encodedEvent,
+			Headers: []kafka.Header{
+				{Key: model.ContentTypeHeader, Value: []byte(contentType)},
+			},
 		}, nil); err != nil {
 			return err
 		}
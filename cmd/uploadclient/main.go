@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -10,62 +13,239 @@ import (
 	"mmoviecom/internal/grpcutil"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	chunkSize   = 64 * 1024
+	maxAttempts = 5
+	retryDelay  = time.Second
+	// checksumTrailer defines the trailer of DownloadFile
+	// with the SHA-256 checksum of the streamed bytes.
+	checksumTrailer = "sha256"
 )
 
 func main() {
+	download := flag.String("download", "", "name of a file to download instead of uploading")
+	offset := flag.Int64("offset", 0, "offset of the downloaded range")
+	length := flag.Int64("length", 0, "length of the downloaded range, 0 for the rest of the file")
+	out := flag.String("out", "", "path of the downloaded file, the file name by default")
+	movieID := flag.String("movie", "", "id of a movie to link the uploaded file to")
+	kind := flag.String("kind", "poster", "asset kind of the uploaded file linked to a movie: poster, trailer or subtitle")
+	overwrite := flag.Bool("overwrite", false, "replace a stored file with the same name")
+	token := flag.String("token", os.Getenv("MOVIE_TOKEN"), "auth token, MOVIE_TOKEN by default")
+	flag.Parse()
+
 	conn, err := grpc.NewClient("localhost:8083", grpc.WithTransportCredentials(grpcutil.GetX509Credentials("cert.crt", "cert.key")))
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
 	defer conn.Close()
 	client := gen.NewMovieServiceClient(conn)
+	if *download != "" {
+		outPath := *out
+		if outPath == "" {
+			outPath = path.Base(*download)
+		}
+		if err := downloadFile(context.Background(), client, *token, *download, *offset, *length, outPath); err != nil {
+			log.Fatalf("Failed to download file: %v", err)
+		}
+		return
+	}
 	filePath := "upload.txt"
-	if err := uploadFile(client, filePath); err != nil {
+	if flag.NArg() > 0 {
+		filePath = flag.Arg(0)
+	}
+	assetKind := ""
+	if *movieID != "" {
+		assetKind = *kind
+	}
+	if err := uploadFile(context.Background(), client, *token, filePath, *movieID, assetKind, *overwrite); err != nil {
 		log.Fatalf("Failed to upload file: %v", err)
 	}
 }
 
-func uploadFile(client gen.MovieServiceClient, filePath string) error {
+// uploadFile uploads a file with a resumable upload. The upload id is kept
+// in a state file next to the file, so an interrupted upload is resumed by
+// running the client again. If movieID is not empty, the uploaded file is
+// linked to the movie as an asset of the kind. A stored file with the same
+// name is replaced only if overwrite is true.
+func uploadFile(ctx context.Context, client gen.MovieServiceClient, token string, filePath string, movieID string, kind string, overwrite bool) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
-	base := path.Base(filePath)
+	size, checksum, err := digest(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
 
-	stream, err := client.UploadFile(context.Background())
+	statePath := filePath + ".upload"
+	req := &gen.InitUploadRequest{
+		Filename:  path.Base(filePath),
+		Size:      size,
+		Sha256:    checksum,
+		MovieId:   movieID,
+		AssetKind: kind,
+		Token:     token,
+		Overwrite: overwrite,
+	}
+	uploadID, err := resumableUpload(ctx, client, statePath, req)
 	if err != nil {
-		return fmt.Errorf("failed to upload stream: %w", err)
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := uploadChunks(ctx, client, token, file, uploadID)
+		if err == nil && !resp.GetCompleted() {
+			err = fmt.Errorf("incomplete upload: %s", resp.GetMessage())
+		}
+		if err == nil {
+			if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Failed to remove upload state: %v", err)
+			}
+			fmt.Println("Server response: ", resp.GetMessage())
+			fmt.Printf("Stored as %s\n", resp.GetFilename())
+			fmt.Printf("Size: %d, content type: %s, SHA-256: %s\n", resp.GetSize(), resp.GetContentType(), resp.GetSha256())
+			if resp.GetAsset() != nil {
+				fmt.Printf("Linked to movie %s as %s\n", resp.GetMovieId(), resp.GetAsset().GetKind())
+			}
+			return nil
+		}
+		if c := status.Code(err); c == codes.InvalidArgument || c == codes.AlreadyExists {
+			// The upload cannot be resumed, the next run starts a new one.
+			if err := os.Remove(statePath); err != nil {
+				log.Printf("Failed to remove upload state: %v", err)
+			}
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+		if status.Code(err) != codes.NotFound {
+			log.Printf("Upload interrupted, resuming: %v", err)
+			time.Sleep(retryDelay)
+			continue
+		}
+		// The upload expired or was discarded because its file could not
+		// be linked to the movie, so a new one is started.
+		log.Printf("Upload not found, restarting: %v", err)
+		time.Sleep(retryDelay)
+		if uploadID, err = resumableUpload(ctx, client, statePath, req); err != nil {
+			return err
+		}
+	}
+}
+
+// resumableUpload returns the id of the upload saved in the state file
+// or starts a new upload with the request and saves its id.
+func resumableUpload(ctx context.Context, client gen.MovieServiceClient, statePath string, req *gen.InitUploadRequest) (string, error) {
+	if b, err := os.ReadFile(statePath); err == nil {
+		uploadID := strings.TrimSpace(string(b))
+		if _, err := client.QueryUploadStatus(ctx, &gen.QueryUploadStatusRequest{UploadId: uploadID}); err == nil {
+			return uploadID, nil
+		} else if status.Code(err) != codes.NotFound {
+			return "", fmt.Errorf("failed to query upload status: %w", err)
+		}
 	}
-	buf := make([]byte, 1024)
+	resp, err := client.InitUpload(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to init upload: %w", err)
+	}
+	if err := os.WriteFile(statePath, []byte(resp.GetUploadId()), 0o600); err != nil {
+		return "", fmt.Errorf("failed to save upload state: %w", err)
+	}
+	return resp.GetUploadId(), nil
+}
+
+// uploadChunks sends the chunks of a file the server has not received yet.
+func uploadChunks(ctx context.Context, client gen.MovieServiceClient, token string, file *os.File, uploadID string) (*gen.UploadResponse, error) {
+	st, err := client.QueryUploadStatus(ctx, &gen.QueryUploadStatusRequest{UploadId: uploadID})
+	if err != nil {
+		return nil, err
+	}
+	if st.GetCompleted() {
+		return &gen.UploadResponse{
+			Message:   fmt.Sprintf("File %s uploaded successfully", st.GetFilename()),
+			Filename:  st.GetFilename(),
+			Size:      st.GetSize(),
+			Completed: true,
+		}, nil
+	}
+	offset := st.GetReceived()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	stream, err := client.UploadFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, chunkSize)
 	for {
 		n, err := file.Read(buf)
-		if err == io.EOF {
+		if errors.Is(err, io.EOF) {
 			break
+		} else if err != nil {
+			return nil, err
 		}
-		if err != nil {
+		if err := stream.Send(&gen.UploadRequest{UploadId: uploadID, Offset: offset, Chunk: buf[:n], Token: token}); err != nil {
 			if errors.Is(err, io.EOF) {
+				// The server closed the stream, its status is returned by CloseAndRecv.
 				break
-			} else {
-				return fmt.Errorf("failed to read file: %w", err)
 			}
+			return nil, err
 		}
-
-		if err := stream.Send(&gen.UploadRequest{
-			Filename: base,
-			Chunk:    buf[:n],
-		}); err != nil {
-			return fmt.Errorf("failed to send chunk: %w", err)
-		}
+		offset += int64(n)
 	}
+	return stream.CloseAndRecv()
+}
 
-	resp, err := stream.CloseAndRecv()
+// digest returns the size and the SHA-256 checksum of a file.
+func digest(file *os.File) (int64, string, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, file)
 	if err != nil {
-		return fmt.Errorf("failed to receive response: %w", err)
+		return 0, "", err
 	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	fmt.Println("Server response: ", resp.GetMessage())
+// downloadFile downloads a range of a file to outPath and verifies
+// the checksum of the received bytes.
+func downloadFile(ctx context.Context, client gen.MovieServiceClient, token string, filename string, offset int64, length int64, outPath string) error {
+	stream, err := client.DownloadFile(ctx, &gen.DownloadRequest{Filename: filename, Offset: offset, Length: length, Token: token})
+	if err != nil {
+		return fmt.Errorf("failed to download stream: %w", err)
+	}
+	file, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+	h := sha256.New()
+	var received, size int64
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to receive chunk: %w", err)
+		}
+		if _, err := io.MultiWriter(file, h).Write(resp.GetChunk()); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		received += int64(len(resp.GetChunk()))
+		size = resp.GetSize()
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if want := stream.Trailer().Get(checksumTrailer); len(want) != 1 || want[0] != checksum {
+		return fmt.Errorf("checksum mismatch: got %s, want %v", checksum, want)
+	}
+	fmt.Printf("Downloaded %d bytes of %s (%d bytes) to %s, SHA-256: %s\n", received, filename, size, outPath, checksum)
 	return nil
 }
@@ -41,6 +41,20 @@ func (m *MockmetadataRepository) EXPECT() *MockmetadataRepositoryMockRecorder {
 	return m.recorder
 }
 
+// Create mocks base method.
+func (m *MockmetadataRepository) Create(ctx context.Context, id string, metadata *model.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, id, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockmetadataRepositoryMockRecorder) Create(ctx, id, metadata any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockmetadataRepository)(nil).Create), ctx, id, metadata)
+}
+
 // Get mocks base method.
 func (m *MockmetadataRepository) Get(ctx context.Context, id string) (*model.Metadata, error) {
 	m.ctrl.T.Helper()
@@ -56,6 +70,21 @@ func (mr *MockmetadataRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockmetadataRepository)(nil).Get), ctx, id)
 }
 
+// List mocks base method.
+func (m *MockmetadataRepository) List(ctx context.Context, offset, limit int) ([]model.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, offset, limit)
+	ret0, _ := ret[0].([]model.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockmetadataRepositoryMockRecorder) List(ctx, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockmetadataRepository)(nil).List), ctx, offset, limit)
+}
+
 // Put mocks base method.
 func (m *MockmetadataRepository) Put(ctx context.Context, id string, metadata *model.Metadata) error {
 	m.ctrl.T.Helper()
@@ -69,3 +98,17 @@ func (mr *MockmetadataRepositoryMockRecorder) Put(ctx, id, metadata any) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockmetadataRepository)(nil).Put), ctx, id, metadata)
 }
+
+// PutAsset mocks base method.
+func (m *MockmetadataRepository) PutAsset(ctx context.Context, id string, asset *model.Asset) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutAsset", ctx, id, asset)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutAsset indicates an expected call of PutAsset.
+func (mr *MockmetadataRepositoryMockRecorder) PutAsset(ctx, id, asset any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAsset", reflect.TypeOf((*MockmetadataRepository)(nil).PutAsset), ctx, id, asset)
+}
@@ -1,6 +1,6 @@
 module mmoviecom
 
-go 1.24.4
+go 1.25.0
 
 require (
 	github.com/confluentinc/confluent-kafka-go v1.9.2
@@ -0,0 +1,70 @@
+package grpcutil
+
+import (
+	"fmt"
+	"mmoviecom/pkg/lb"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// balancerName returns the name of the gRPC balancer of a load-balancing policy.
+func balancerName(policy lb.Policy) string {
+	return "mmoviecom_" + string(policy)
+}
+
+func init() {
+	for _, policy := range lb.Policies {
+		balancer.Register(base.NewBalancerBuilder(balancerName(policy), &pickerBuilder{policy: policy}, base.Config{HealthCheck: true}))
+	}
+}
+
+// serviceConfig returns the gRPC service config selecting a load-balancing policy.
+func serviceConfig(policy lb.Policy) string {
+	return fmt.Sprintf(`{"loadBalancingConfig": [{"%s": {}}]}`, balancerName(policy))
+}
+
+// pickerBuilder builds pickers of ready subconnections for a policy.
+type pickerBuilder struct {
+	policy lb.Policy
+}
+
+// Build creates a picker of the ready subconnections. Outstanding
+// requests are counted per picker, so they start from zero whenever
+// the set of ready subconnections changes.
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{selector: lb.NewSelector(b.policy)}
+	for sc := range info.ReadySCs {
+		p.subConns = append(p.subConns, sc)
+		p.outstanding = append(p.outstanding, &atomic.Int64{})
+	}
+	return p
+}
+
+// picker picks a subconnection for every RPC according to a policy.
+type picker struct {
+	selector    *lb.Selector
+	subConns    []balancer.SubConn
+	outstanding []*atomic.Int64
+}
+
+// Pick returns the subconnection of an RPC.
+func (p *picker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	if len(p.subConns) == 0 {
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+	i := p.selector.Choose(len(p.subConns), func(i int) int64 {
+		return p.outstanding[i].Load()
+	})
+	p.outstanding[i].Add(1)
+	return balancer.PickResult{
+		SubConn: p.subConns[i],
+		Done: func(balancer.DoneInfo) {
+			p.outstanding[i].Add(-1)
+		},
+	}, nil
+}
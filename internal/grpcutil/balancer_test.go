@@ -0,0 +1,48 @@
+package grpcutil
+
+import (
+	"encoding/json"
+	"mmoviecom/pkg/lb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestServiceConfig(t *testing.T) {
+	for _, policy := range lb.Policies {
+		var cfg map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(serviceConfig(policy)), &cfg))
+		assert.NotNil(t, balancer.Get(balancerName(policy)), "balancer of %s is registered", policy)
+	}
+}
+
+func TestPickerLeastOutstanding(t *testing.T) {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, addr := range []string{"localhost:8082", "localhost:9082"} {
+		info.ReadySCs[&testSubConn{addr: addr}] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+	}
+	p := (&pickerBuilder{policy: lb.LeastOutstanding}).Build(info)
+
+	first, err := p.Pick(balancer.PickInfo{})
+	assert.NoError(t, err)
+	second, err := p.Pick(balancer.PickInfo{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.SubConn, second.SubConn, "busy subconnection is avoided")
+	first.Done(balancer.DoneInfo{})
+	third, err := p.Pick(balancer.PickInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, first.SubConn, third.SubConn, "finished RPCs are no longer outstanding")
+
+	_, err = (&pickerBuilder{policy: lb.RoundRobin}).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{})
+	assert.ErrorIs(t, err, balancer.ErrNoSubConnAvailable)
+	_, err = (&picker{selector: lb.NewSelector(lb.PowerOfTwo)}).Pick(balancer.PickInfo{})
+	assert.ErrorIs(t, err, balancer.ErrNoSubConnAvailable, "empty pickers do not panic")
+}
@@ -1,33 +1,14 @@
 package grpcutil
 
 import (
-	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"log"
-	"math/rand"
-	"mmoviecom/pkg/discovery"
 	"os"
 
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
-// ServiceConnection attempts to select a random service instance
-// and returns a gRPC connection to it.
-func ServiceConnection(ctx context.Context, serviceName string, registry discovery.Registry, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
-	addrs, err := registry.ServiceAddresses(ctx, serviceName)
-	if err != nil {
-		return nil, err
-	}
-	return grpc.NewClient(
-		addrs[rand.Intn(len(addrs))],
-		grpc.WithTransportCredentials(creds),
-		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
-	)
-}
-
 // GetX509Credentials reads cert and key files and prepares TLS credentials.
 func GetX509Credentials(c string, k string) credentials.TransportCredentials {
 	certBytes, err := os.ReadFile(c)
@@ -0,0 +1,84 @@
+package grpcutil
+
+import (
+	"errors"
+	"fmt"
+	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/lb"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+)
+
+// registryPollInterval defines how often pooled connections look up
+// service addresses in the registry.
+const registryPollInterval = 5 * time.Second
+
+// ConnPool defines a pool of long-lived gRPC connections, one per service.
+// Connections resolve service instances through a service registry and
+// follow instances as they come and go.
+type ConnPool struct {
+	sync.Mutex
+	builder  resolver.Builder
+	creds    credentials.TransportCredentials
+	policies map[string]lb.Policy
+	conns    map[string]*grpc.ClientConn
+}
+
+// NewConnPool creates a new gRPC connection pool. Calls are balanced across
+// service instances with the policies of the services, keyed by service name,
+// or with lb.DefaultPolicy.
+func NewConnPool(registry discovery.Registry, creds credentials.TransportCredentials, policies map[string]lb.Policy) (*ConnPool, error) {
+	for serviceName, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("service %s: %w", serviceName, err)
+		}
+	}
+	return &ConnPool{
+		builder:  NewResolverBuilder(registry, registryPollInterval),
+		creds:    creds,
+		policies: policies,
+		conns:    map[string]*grpc.ClientConn{},
+	}, nil
+}
+
+// Get returns the connection to a service, creating it on the first call.
+func (p *ConnPool) Get(serviceName string) (*grpc.ClientConn, error) {
+	p.Lock()
+	defer p.Unlock()
+	if conn, ok := p.conns[serviceName]; ok {
+		return conn, nil
+	}
+	policy, ok := p.policies[serviceName]
+	if !ok {
+		policy = lb.DefaultPolicy
+	}
+	conn, err := grpc.NewClient(
+		RegistryScheme+":///"+serviceName,
+		grpc.WithResolvers(p.builder),
+		grpc.WithDefaultServiceConfig(serviceConfig(policy)),
+		grpc.WithTransportCredentials(p.creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[serviceName] = conn
+	return conn, nil
+}
+
+// Close closes all pooled connections.
+func (p *ConnPool) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	var errs []error
+	for serviceName, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, serviceName)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package grpcutil
+
+import (
+	"context"
+	"mmoviecom/pkg/discovery"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// RegistryScheme defines the scheme of targets resolved through a service
+// registry, such as "registry:///rating".
+const RegistryScheme = "registry"
+
+// resolveTimeout defines how long a resolver waits for the registry.
+const resolveTimeout = 5 * time.Second
+
+// registryResolverBuilder defines a gRPC resolver builder resolving
+// service names into instance addresses through a service registry.
+type registryResolverBuilder struct {
+	registry discovery.Registry
+	interval time.Duration
+}
+
+// NewResolverBuilder creates a gRPC resolver builder backed by a service
+// registry. Resolvers poll the registry for service addresses every interval
+// and update their connections when the addresses change.
+func NewResolverBuilder(registry discovery.Registry, interval time.Duration) resolver.Builder {
+	return &registryResolverBuilder{registry: registry, interval: interval}
+}
+
+// Build creates a resolver of a target service name.
+func (b *registryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registryResolver{
+		registry:    b.registry,
+		serviceName: target.Endpoint(),
+		cc:          cc,
+		interval:    b.interval,
+		resolveNow:  make(chan struct{}, 1),
+		cancel:      cancel,
+	}
+	r.wg.Add(1)
+	go r.watch(ctx)
+	return r, nil
+}
+
+// Scheme returns the scheme of targets resolved by the builder.
+func (b *registryResolverBuilder) Scheme() string {
+	return RegistryScheme
+}
+
+// registryResolver defines a resolver of a single service.
+type registryResolver struct {
+	registry    discovery.Registry
+	serviceName string
+	cc          resolver.ClientConn
+	interval    time.Duration
+	resolveNow  chan struct{}
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// ResolveNow requests an immediate registry lookup.
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the resolver.
+func (r *registryResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *registryResolver) watch(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	var addrs []string
+	for {
+		addrs = r.resolve(ctx, addrs)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+	}
+}
+
+// resolve looks up the service addresses and updates the connection
+// if they differ from the previous ones, which are returned otherwise.
+func (r *registryResolver) resolve(ctx context.Context, prev []string) []string {
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := r.registry.ServiceAddresses(ctx, r.serviceName)
+	if err != nil {
+		r.cc.ReportError(err)
+		return nil
+	}
+	addrs = slices.Clone(addrs)
+	slices.Sort(addrs)
+	if slices.Equal(addrs, prev) {
+		return prev
+	}
+	state := resolver.State{}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		// The connection asks for a new resolution through ResolveNow.
+		return nil
+	}
+	return addrs
+}
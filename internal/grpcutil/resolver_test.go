@@ -0,0 +1,86 @@
+package grpcutil
+
+import (
+	"context"
+	"mmoviecom/pkg/discovery/memory"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+)
+
+type testClientConn struct {
+	resolver.ClientConn
+	sync.Mutex
+	states []resolver.State
+	errs   []error
+}
+
+func (cc *testClientConn) UpdateState(state resolver.State) error {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.states = append(cc.states, state)
+	return nil
+}
+
+func (cc *testClientConn) ReportError(err error) {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.errs = append(cc.errs, err)
+}
+
+func (cc *testClientConn) lastAddrs() []string {
+	cc.Lock()
+	defer cc.Unlock()
+	if len(cc.states) == 0 {
+		return nil
+	}
+	var res []string
+	for _, a := range cc.states[len(cc.states)-1].Addresses {
+		res = append(res, a.Addr)
+	}
+	return res
+}
+
+func TestRegistryResolver(t *testing.T) {
+	ctx := context.Background()
+	registry := memory.NewRegistry(zap.NewNop())
+	assert.NoError(t, registry.Register(ctx, "rating-1", "rating", "localhost:8082"))
+
+	b := NewResolverBuilder(registry, time.Hour)
+	assert.Equal(t, RegistryScheme, b.Scheme())
+	target, err := url.Parse("registry:///rating")
+	assert.NoError(t, err)
+	cc := &testClientConn{}
+	r, err := b.Build(resolver.Target{URL: *target}, cc, resolver.BuildOptions{})
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"localhost:8082"}, cc.lastAddrs())
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, registry.Register(ctx, "rating-2", "rating", "localhost:9082"))
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"localhost:8082", "localhost:9082"}, cc.lastAddrs())
+	}, time.Second, time.Millisecond)
+
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	time.Sleep(10 * time.Millisecond)
+	cc.Lock()
+	assert.Len(t, cc.states, 2, "unchanged addresses are not updated")
+	cc.Unlock()
+
+	assert.NoError(t, registry.Deregister(ctx, "rating-1", "rating"))
+	assert.NoError(t, registry.Deregister(ctx, "rating-2", "rating"))
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Eventually(t, func() bool {
+		cc.Lock()
+		defer cc.Unlock()
+		return len(cc.errs) == 1
+	}, time.Second, time.Millisecond, "missing service is reported as an error")
+}
@@ -5,17 +5,33 @@ import (
 	"errors"
 	"mmoviecom/metadata/internal/repository"
 	"mmoviecom/metadata/pkg/model"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 
 	"go.uber.org/zap"
 )
 
 // ErrNotFound is returned when a requested record is not found.
-var ErrNotFound = errors.New("not found")
+var ErrNotFound = errs.NotFound("movie metadata not found")
+
+// ErrAlreadyExists is returned when creating metadata of an existing movie.
+var ErrAlreadyExists = errs.AlreadyExists("movie metadata already exists")
+
+// ErrInvalidAsset is returned when an asset has no file name or an unsupported kind.
+var ErrInvalidAsset = errs.InvalidArgument("asset file name and a supported kind are required")
+
+// Metadata list page sizes.
+const (
+	DefaultListPageSize = 20
+	MaxListPageSize     = 100
+)
 
 type metadataRepository interface {
 	Get(ctx context.Context, id string) (*model.Metadata, error)
 	Put(ctx context.Context, id string, metadata *model.Metadata) error
+	Create(ctx context.Context, id string, metadata *model.Metadata) error
+	List(ctx context.Context, offset int, limit int) ([]model.Metadata, error)
+	PutAsset(ctx context.Context, id string, asset *model.Asset) error
 }
 
 // Controller defines a metadata service controller.
@@ -55,8 +71,74 @@ func (c *Controller) Get(ctx context.Context, id string) (*model.Metadata, error
 	return res, err
 }
 
-// Put stores metadata in the repository.
+// Put stores metadata in the repository and refreshes the cached copy,
+// which is read back from the repository to include the movie assets.
 func (c *Controller) Put(ctx context.Context, id string, metadata *model.Metadata) error {
-	err := c.repo.Put(ctx, id, metadata)
-	return err
+	if err := c.repo.Put(ctx, id, metadata); err != nil {
+		return err
+	}
+	c.refresh(ctx, id)
+	return nil
+}
+
+// Create stores metadata of a new movie in the repository and caches it.
+// It returns ErrAlreadyExists if the movie exists, the check and the write
+// are a single repository operation.
+func (c *Controller) Create(ctx context.Context, id string, metadata *model.Metadata) error {
+	err := c.repo.Create(ctx, id, metadata)
+	if err != nil && errors.Is(err, repository.ErrAlreadyExists) {
+		return ErrAlreadyExists
+	} else if err != nil {
+		return err
+	}
+	c.refresh(ctx, id)
+	return nil
+}
+
+// refresh replaces the cached copy of movie metadata with the stored one.
+func (c *Controller) refresh(ctx context.Context, id string) {
+	res, err := c.repo.Get(ctx, id)
+	if err != nil {
+		c.logger.Info("Error reading stored metadata", zap.Error(err))
+		return
+	}
+	if err := c.cache.Put(ctx, id, res); err != nil {
+		c.logger.Info("Error updating cache", zap.Error(err))
+	}
+}
+
+// PutAsset adds or replaces an asset of a movie, identified by its kind
+// and file name, and refreshes the cached copy of the movie metadata.
+func (c *Controller) PutAsset(ctx context.Context, id string, asset *model.Asset) error {
+	if asset == nil || asset.Filename == "" || asset.Kind.Validate() != nil {
+		return ErrInvalidAsset
+	}
+	err := c.repo.PutAsset(ctx, id, asset)
+	if err != nil && errors.Is(err, repository.ErrNotFound) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := c.cache.PutAsset(ctx, id, asset); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		c.logger.Info("Error updating cache", zap.Error(err))
+	}
+	return nil
+}
+
+// List returns a page of movie metadata ordered by title and movie id, and the offset
+// of the next page or 0 if there are no more movies.
+func (c *Controller) List(ctx context.Context, offset int, pageSize int) ([]model.Metadata, int, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+	pageSize = min(pageSize, MaxListPageSize)
+	offset = max(offset, 0)
+	res, err := c.repo.List(ctx, offset, pageSize+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(res) <= pageSize {
+		return res, 0, nil
+	}
+	return res[:pageSize], offset + pageSize, nil
 }
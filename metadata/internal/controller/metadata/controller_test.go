@@ -108,9 +108,11 @@ func TestControllerGet(t *testing.T) {
 
 func TestControllerPut(t *testing.T) {
 	tests := []struct {
-		name       string
-		expRepoErr error
-		wantErr    error
+		name         string
+		expRepoErr   error
+		cachePutErr  error
+		cachePutCall bool
+		wantErr      error
 	}{
 		{
 			name:       "unexpected error",
@@ -118,7 +120,13 @@ func TestControllerPut(t *testing.T) {
 			wantErr:    errors.New("unexpected error"),
 		},
 		{
-			name: "success",
+			name:         "success",
+			cachePutCall: true,
+		},
+		{
+			name:         "cache put error",
+			cachePutErr:  errors.New("unexpected error"),
+			cachePutCall: true,
 		},
 	}
 
@@ -140,9 +148,182 @@ func TestControllerPut(t *testing.T) {
 				Description: "description",
 				Director:    "director",
 			}
+			stored := m
+			stored.Assets = []model.Asset{{Kind: model.AssetKindPoster, Filename: "poster.png"}}
 			repoMock.EXPECT().Put(ctx, m.ID, &m).Return(tt.expRepoErr)
+			if tt.cachePutCall {
+				repoMock.EXPECT().Get(ctx, m.ID).Return(&stored, nil)
+				cacheMock.EXPECT().Put(ctx, m.ID, &stored).Return(tt.cachePutErr)
+			}
 			err = c.Put(ctx, m.ID, &m)
 			assert.Equal(t, tt.wantErr, err, tt.name)
 		})
 	}
 }
+
+func TestControllerCreate(t *testing.T) {
+	metadata := &model.Metadata{ID: "id", Title: "title"}
+	tests := []struct {
+		name         string
+		expRepoErr   error
+		cachePutCall bool
+		wantErr      error
+	}{
+		{
+			name:         "success",
+			cachePutCall: true,
+		},
+		{
+			name:       "already exists",
+			expRepoErr: repository.ErrAlreadyExists,
+			wantErr:    ErrAlreadyExists,
+		},
+		{
+			name:       "unexpected error",
+			expRepoErr: errors.New("unexpected error"),
+			wantErr:    errors.New("unexpected error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repoMock := gen.NewMockmetadataRepository(ctrl)
+			cacheMock := gen.NewMockmetadataRepository(ctrl)
+			c := New(repoMock, cacheMock, zap.NewNop())
+			ctx := context.Background()
+			repoMock.EXPECT().Create(ctx, "id", metadata).Return(tt.expRepoErr)
+			if tt.cachePutCall {
+				repoMock.EXPECT().Get(ctx, "id").Return(metadata, nil)
+				cacheMock.EXPECT().Put(ctx, "id", metadata).Return(nil)
+			}
+			err := c.Create(ctx, "id", metadata)
+			assert.Equal(t, tt.wantErr, err, tt.name)
+		})
+	}
+}
+
+func TestControllerPutAsset(t *testing.T) {
+	asset := &model.Asset{Kind: model.AssetKindTrailer, Filename: "trailer.mp4"}
+	tests := []struct {
+		name         string
+		asset        *model.Asset
+		expRepoCall  bool
+		expRepoErr   error
+		cachePutCall bool
+		cachePutErr  error
+		wantErr      error
+	}{
+		{
+			name:    "invalid kind",
+			asset:   &model.Asset{Kind: "cover", Filename: "cover.png"},
+			wantErr: ErrInvalidAsset,
+		},
+		{
+			name:    "no file name",
+			asset:   &model.Asset{Kind: model.AssetKindPoster},
+			wantErr: ErrInvalidAsset,
+		},
+		{
+			name:        "not found",
+			asset:       asset,
+			expRepoCall: true,
+			expRepoErr:  repository.ErrNotFound,
+			wantErr:     ErrNotFound,
+		},
+		{
+			name:         "success",
+			asset:        asset,
+			expRepoCall:  true,
+			cachePutCall: true,
+		},
+		{
+			name:         "movie not cached",
+			asset:        asset,
+			expRepoCall:  true,
+			cachePutCall: true,
+			cachePutErr:  repository.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repoMock := gen.NewMockmetadataRepository(ctrl)
+			cacheMock := gen.NewMockmetadataRepository(ctrl)
+			c := New(repoMock, cacheMock, zap.NewNop())
+			ctx := context.Background()
+			if tt.expRepoCall {
+				repoMock.EXPECT().PutAsset(ctx, "id", tt.asset).Return(tt.expRepoErr)
+			}
+			if tt.cachePutCall {
+				cacheMock.EXPECT().PutAsset(ctx, "id", tt.asset).Return(tt.cachePutErr)
+			}
+			err := c.PutAsset(ctx, "id", tt.asset)
+			assert.Equal(t, tt.wantErr, err, tt.name)
+		})
+	}
+}
+
+func TestControllerList(t *testing.T) {
+	page := []model.Metadata{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	tests := []struct {
+		name       string
+		offset     int
+		pageSize   int
+		expLimit   int
+		expRepoRes []model.Metadata
+		expRepoErr error
+		wantRes    []model.Metadata
+		wantNext   int
+		wantErr    error
+	}{
+		{
+			name:       "last page",
+			pageSize:   3,
+			expLimit:   4,
+			expRepoRes: page,
+			wantRes:    page,
+		},
+		{
+			name:       "next page",
+			offset:     2,
+			pageSize:   2,
+			expLimit:   3,
+			expRepoRes: page,
+			wantRes:    page[:2],
+			wantNext:   4,
+		},
+		{
+			name:       "default page size",
+			expLimit:   DefaultListPageSize + 1,
+			expRepoRes: page,
+			wantRes:    page,
+		},
+		{
+			name:       "unexpected error",
+			pageSize:   MaxListPageSize + 1,
+			expLimit:   MaxListPageSize + 1,
+			expRepoErr: errors.New("unexpected error"),
+			wantErr:    errors.New("unexpected error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repoMock := gen.NewMockmetadataRepository(ctrl)
+			cacheMock := gen.NewMockmetadataRepository(ctrl)
+			c := New(repoMock, cacheMock, zap.NewNop())
+			ctx := context.Background()
+			repoMock.EXPECT().List(ctx, tt.offset, tt.expLimit).Return(tt.expRepoRes, tt.expRepoErr)
+			res, next, err := c.List(ctx, tt.offset, tt.pageSize)
+			assert.Equal(t, tt.wantRes, res, tt.name)
+			assert.Equal(t, tt.wantNext, next, tt.name)
+			assert.Equal(t, tt.wantErr, err, tt.name)
+		})
+	}
+}
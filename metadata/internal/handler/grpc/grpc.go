@@ -2,12 +2,13 @@ package grpc
 
 import (
 	"context"
-	"errors"
 	"mmoviecom/gen"
 	"mmoviecom/metadata/internal/controller/metadata"
 	"mmoviecom/metadata/pkg/model"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
+	"strconv"
 
 	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
@@ -18,10 +19,13 @@ import (
 // Handler deefines a movie metadata gRPC handler.
 type Handler struct {
 	gen.UnimplementedMetadataServiceServer
-	ctrl               *metadata.Controller
-	logger             *zap.Logger
-	getMetadataMetrics *metrics.EndpointMetrics
-	putMetadataMetrics *metrics.EndpointMetrics
+	ctrl                  *metadata.Controller
+	logger                *zap.Logger
+	getMetadataMetrics    *metrics.EndpointMetrics
+	putMetadataMetrics    *metrics.EndpointMetrics
+	createMetadataMetrics *metrics.EndpointMetrics
+	listMetadataMetrics   *metrics.EndpointMetrics
+	putAssetMetrics       *metrics.EndpointMetrics
 }
 
 // New creates a new movie metadata gRPC handler.
@@ -31,10 +35,13 @@ func New(ctrl *metadata.Controller, logger *zap.Logger, scope tally.Scope) *Hand
 		zap.String(logging.FieldType, "grpc"),
 	)
 	return &Handler{
-		ctrl:               ctrl,
-		logger:             logger,
-		getMetadataMetrics: metrics.NewEndpointMetrics(scope, "GetMetadata"),
-		putMetadataMetrics: metrics.NewEndpointMetrics(scope, "PutMetadata"),
+		ctrl:                  ctrl,
+		logger:                logger,
+		getMetadataMetrics:    metrics.NewEndpointMetrics(scope, "GetMetadata"),
+		putMetadataMetrics:    metrics.NewEndpointMetrics(scope, "PutMetadata"),
+		createMetadataMetrics: metrics.NewEndpointMetrics(scope, "CreateMetadata"),
+		listMetadataMetrics:   metrics.NewEndpointMetrics(scope, "ListMetadata"),
+		putAssetMetrics:       metrics.NewEndpointMetrics(scope, "PutAsset"),
 	}
 }
 
@@ -46,12 +53,9 @@ func (h *Handler) GetMetadata(ctx context.Context, req *gen.GetMetadataRequest)
 		return nil, status.Error(codes.InvalidArgument, "nil req or empty id")
 	}
 	m, err := h.ctrl.Get(ctx, req.MovieId)
-	if err != nil && errors.Is(err, metadata.ErrNotFound) {
-		h.getMetadataMetrics.NotFoundErrors.Inc(1)
-		return nil, status.Error(codes.NotFound, err.Error())
-	} else if err != nil {
-		h.getMetadataMetrics.InternalErrors.Inc(1)
-		return nil, status.Error(codes.Internal, err.Error())
+	if err != nil {
+		h.getMetadataMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	h.getMetadataMetrics.Successes.Inc(1)
 	return &gen.GetMetadataResponse{Metadata: model.MetadataToProto(m)}, nil
@@ -65,9 +69,71 @@ func (h *Handler) PutMetadata(ctx context.Context, req *gen.PutMetadataRequest)
 		return nil, status.Error(codes.InvalidArgument, "nil req or metadata")
 	}
 	if err := h.ctrl.Put(ctx, req.Metadata.Id, model.MetadataFromProto(req.Metadata)); err != nil {
-		h.putMetadataMetrics.InternalErrors.Inc(1)
-		return nil, status.Error(codes.Internal, err.Error())
+		h.putMetadataMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	h.putMetadataMetrics.Successes.Inc(1)
 	return &gen.PutMetadataResponse{}, nil
 }
+
+// CreateMetadata receives metadata of a new movie and stores it.
+func (h *Handler) CreateMetadata(ctx context.Context, req *gen.CreateMetadataRequest) (*gen.CreateMetadataResponse, error) {
+	h.createMetadataMetrics.Calls.Inc(1)
+	if req == nil || req.Metadata == nil {
+		h.createMetadataMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or metadata")
+	}
+	if err := h.ctrl.Create(ctx, req.Metadata.Id, model.MetadataFromProto(req.Metadata)); err != nil {
+		h.createMetadataMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.createMetadataMetrics.Successes.Inc(1)
+	return &gen.CreateMetadataResponse{}, nil
+}
+
+// PutAsset links a stored asset to a movie.
+func (h *Handler) PutAsset(ctx context.Context, req *gen.PutAssetRequest) (*gen.PutAssetResponse, error) {
+	h.putAssetMetrics.Calls.Inc(1)
+	if req == nil || req.MovieId == "" || req.Asset == nil {
+		h.putAssetMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req, empty id or nil asset")
+	}
+	if err := h.ctrl.PutAsset(ctx, req.MovieId, model.AssetFromProto(req.Asset)); err != nil {
+		h.putAssetMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.putAssetMetrics.Successes.Inc(1)
+	return &gen.PutAssetResponse{}, nil
+}
+
+// ListMetadata returns a page of movie metadata ordered by title and movie id.
+func (h *Handler) ListMetadata(ctx context.Context, req *gen.ListMetadataRequest) (*gen.ListMetadataResponse, error) {
+	h.listMetadataMetrics.Calls.Inc(1)
+	if req == nil {
+		h.listMetadataMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req")
+	}
+	var offset int
+	if req.PageToken != "" {
+		v, err := strconv.Atoi(req.PageToken)
+		if err != nil || v < 0 {
+			h.listMetadataMetrics.InvalidArgumentErrors.Inc(1)
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		offset = v
+	}
+	res, next, err := h.ctrl.List(ctx, offset, int(req.PageSize))
+	if err != nil {
+		h.listMetadataMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.ListMetadataResponse{}
+	for i := range res {
+		resp.Metadata = append(resp.Metadata, model.MetadataToProto(&res[i]))
+	}
+	if next > 0 {
+		resp.NextPageToken = strconv.Itoa(next)
+	}
+	h.listMetadataMetrics.Successes.Inc(1)
+	return resp, nil
+}
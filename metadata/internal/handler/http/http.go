@@ -2,11 +2,10 @@ package http
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"mmoviecom/metadata/internal/controller/metadata"
-	"mmoviecom/metadata/internal/repository"
 	"mmoviecom/metadata/pkg/model"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"net/http"
 
@@ -40,12 +39,9 @@ func (h *Handler) GetMetadata(w http.ResponseWriter, req *http.Request) {
 	}
 	ctx := req.Context()
 	m, err := h.ctrl.Get(ctx, id)
-	if err != nil && errors.Is(err, repository.ErrNotFound) {
-		w.WriteHeader(http.StatusNotFound)
-		return
-	} else if err != nil {
+	if err != nil {
 		h.logger.Warn("Repository get error for movie", zap.String("id", id), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errs.HTTPStatus(err))
 		return
 	}
 	if err := json.NewEncoder(w).Encode(m); err != nil {
@@ -70,6 +66,7 @@ func (h *Handler) PutMetadata(w http.ResponseWriter, req *http.Request) {
 			)),
 		)
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	ctx := req.Context()
@@ -81,7 +78,7 @@ func (h *Handler) PutMetadata(w http.ResponseWriter, req *http.Request) {
 	})
 	if err != nil {
 		h.logger.Warn("Repository put error", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errs.HTTPStatus(err))
 	}
 }
 
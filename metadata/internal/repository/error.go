@@ -4,3 +4,6 @@ import "errors"
 
 // ErrNotFound is returned when requested record is not found.
 var ErrNotFound = errors.New("not found")
+
+// ErrAlreadyExists is returned when a created record already exists.
+var ErrAlreadyExists = errors.New("already exists")
@@ -5,6 +5,8 @@ import (
 	"mmoviecom/metadata/internal/repository"
 	"mmoviecom/metadata/pkg/model"
 	"mmoviecom/pkg/logging"
+	"slices"
+	"sort"
 	"sync"
 
 	"go.opentelemetry.io/otel"
@@ -42,12 +44,75 @@ func (r *Repository) Get(ctx context.Context, id string) (*model.Metadata, error
 	return m, nil
 }
 
-// Put adds movie metadata for a given movie id.
+// Put adds movie metadata for a given movie id. The assets of
+// the movie are kept, they are added with PutAsset.
 func (r *Repository) Put(ctx context.Context, _ string, m *model.Metadata) error {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Put")
 	defer span.End()
 	r.Lock()
 	defer r.Unlock()
-	r.data[m.ID] = m
+	res := *m
+	res.Assets = nil
+	if current, ok := r.data[m.ID]; ok {
+		res.Assets = current.Assets
+	}
+	r.data[m.ID] = &res
+	return nil
+}
+
+// Create adds movie metadata for a new movie id. It returns
+// repository.ErrAlreadyExists if the movie exists.
+func (r *Repository) Create(ctx context.Context, _ string, m *model.Metadata) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Create")
+	defer span.End()
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.data[m.ID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	res := *m
+	res.Assets = nil
+	r.data[m.ID] = &res
+	return nil
+}
+
+// PutAsset adds or replaces an asset of a movie, identified by its kind and file name.
+func (r *Repository) PutAsset(ctx context.Context, id string, asset *model.Asset) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/PutAsset")
+	defer span.End()
+	r.Lock()
+	defer r.Unlock()
+	current, ok := r.data[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	m := *current
+	m.Assets = slices.DeleteFunc(slices.Clone(current.Assets), func(a model.Asset) bool {
+		return a.Kind == asset.Kind && a.Filename == asset.Filename
+	})
+	m.Assets = append(m.Assets, *asset)
+	r.data[id] = &m
 	return nil
 }
+
+// List retrieves movie metadata ordered by title and movie id.
+func (r *Repository) List(ctx context.Context, offset int, limit int) ([]model.Metadata, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/List")
+	defer span.End()
+	r.RLock()
+	res := make([]model.Metadata, 0, len(r.data))
+	for _, m := range r.data {
+		res = append(res, *m)
+	}
+	r.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Title != res[j].Title {
+			return res[i].Title < res[j].Title
+		}
+		return res[i].ID < res[j].ID
+	})
+	if offset >= len(res) {
+		return nil, nil
+	}
+	return res[offset:min(offset+limit, len(res))], nil
+}
@@ -10,13 +10,16 @@ import (
 	"mmoviecom/metadata/pkg/model"
 	"mmoviecom/pkg/logging"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 )
 
 const tracerID = "metadata-repository-mysql"
 
+// errDuplicateEntry is the MySQL error number of a duplicate key.
+const errDuplicateEntry = 1062
+
 // Repository defines a MySQL-based movie metadata repository.
 type Repository struct {
 	db     *sql.DB
@@ -42,33 +45,117 @@ func New(config configs.MysqlConfig, logger *zap.Logger) (*Repository, error) {
 func (r *Repository) Get(ctx context.Context, id string) (*model.Metadata, error) {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Get")
 	defer span.End()
-	var title, description, director string
+	var title, description, director, poster string
 	r.logger.Info("Trying to get metadata from MySQL", zap.String("id", id))
-	row := r.db.QueryRowContext(ctx, "SELECT title, description, director FROM movies WHERE id=?", id)
-	if err := row.Scan(&title, &description, &director); err != nil {
+	row := r.db.QueryRowContext(ctx, "SELECT title, description, director, poster FROM movies WHERE id=?", id)
+	if err := row.Scan(&title, &description, &director, &poster); err != nil {
 		r.logger.Warn("Failed to get metadata from MySQL", zap.String("id", id), zap.Error(err))
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, repository.ErrNotFound
 		}
 		return nil, err
 	}
+	assets, err := r.getAssets(ctx, id)
+	if err != nil {
+		r.logger.Warn("Failed to get assets from MySQL", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
 	return &model.Metadata{
 		ID:          id,
 		Title:       title,
 		Description: description,
 		Director:    director,
+		Poster:      poster,
+		Assets:      assets,
 	}, nil
 }
 
-// Put adds movie metadata for a given movie id.
+func (r *Repository) getAssets(ctx context.Context, id string) ([]model.Asset, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT kind, filename, path, size, content_type, sha256 FROM movie_assets WHERE movie_id=? ORDER BY kind, filename", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.Asset
+	for rows.Next() {
+		var a model.Asset
+		if err := rows.Scan(&a.Kind, &a.Filename, &a.Path, &a.Size, &a.ContentType, &a.SHA256); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// Put adds or replaces movie metadata for a given movie id.
+// The assets of the movie are kept, they are added with PutAsset.
 func (r *Repository) Put(ctx context.Context, id string, m *model.Metadata) error {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Put")
 	defer span.End()
 	r.logger.Info("Trying to put metadata to MySQL", zap.String("id", id))
-	_, err := r.db.ExecContext(ctx, "INSERT INTO movies (id, title, description, director) VALUES (?, ?, ?, ?)",
-		id, m.Title, m.Description, m.Director)
+	_, err := r.db.ExecContext(ctx, `INSERT INTO movies (id, title, description, director, poster) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE title = VALUES(title), description = VALUES(description), director = VALUES(director), poster = VALUES(poster)`,
+		id, m.Title, m.Description, m.Director, m.Poster)
 	if err != nil {
 		r.logger.Warn("Failed to get metadata ti MySQL", zap.String("id", id), zap.Error(err))
 	}
 	return err
 }
+
+// Create adds movie metadata for a new movie id. It returns
+// repository.ErrAlreadyExists if the movie exists.
+func (r *Repository) Create(ctx context.Context, id string, m *model.Metadata) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Create")
+	defer span.End()
+	r.logger.Info("Trying to create metadata in MySQL", zap.String("id", id))
+	_, err := r.db.ExecContext(ctx, "INSERT INTO movies (id, title, description, director, poster) VALUES (?, ?, ?, ?, ?)",
+		id, m.Title, m.Description, m.Director, m.Poster)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		return repository.ErrAlreadyExists
+	} else if err != nil {
+		r.logger.Warn("Failed to create metadata in MySQL", zap.String("id", id), zap.Error(err))
+	}
+	return err
+}
+
+// PutAsset adds or replaces an asset of a movie, identified by its kind and file name.
+func (r *Repository) PutAsset(ctx context.Context, id string, asset *model.Asset) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/PutAsset")
+	defer span.End()
+	r.logger.Info("Trying to put asset to MySQL", zap.String("id", id), zap.String("filename", asset.Filename))
+	var exists int
+	if err := r.db.QueryRowContext(ctx, "SELECT 1 FROM movies WHERE id=?", id).Scan(&exists); errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO movie_assets (movie_id, kind, filename, path, size, content_type, sha256) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE path = VALUES(path), size = VALUES(size), content_type = VALUES(content_type), sha256 = VALUES(sha256)`,
+		id, asset.Kind, asset.Filename, asset.Path, asset.Size, asset.ContentType, asset.SHA256)
+	if err != nil {
+		r.logger.Warn("Failed to put asset to MySQL", zap.String("id", id), zap.Error(err))
+	}
+	return err
+}
+
+// List retrieves movie metadata ordered by title and movie id, without their assets.
+func (r *Repository) List(ctx context.Context, offset int, limit int) ([]model.Metadata, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/List")
+	defer span.End()
+	rows, err := r.db.QueryContext(ctx, "SELECT id, title, description, director, poster FROM movies ORDER BY title, id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		r.logger.Warn("Failed to list metadata from MySQL", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.Metadata
+	for rows.Next() {
+		var m model.Metadata
+		if err := rows.Scan(&m.ID, &m.Title, &m.Description, &m.Director, &m.Poster); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"fmt"
+	"mmoviecom/gen"
+)
+
+// AssetKind defines a kind of movie asset.
+type AssetKind string
+
+// Movie asset kinds.
+const (
+	AssetKindPoster   AssetKind = "poster"
+	AssetKindTrailer  AssetKind = "trailer"
+	AssetKindSubtitle AssetKind = "subtitle"
+)
+
+// Validate returns an error if the asset kind is not supported.
+func (k AssetKind) Validate() error {
+	switch k {
+	case AssetKindPoster, AssetKindTrailer, AssetKindSubtitle:
+		return nil
+	default:
+		return fmt.Errorf("unsupported asset kind: %s", k)
+	}
+}
+
+// Asset defines a file uploaded to the movie service and linked to a movie.
+// Path is the name the file is stored and downloaded under.
+type Asset struct {
+	Kind        AssetKind `json:"kind"`
+	Filename    string    `json:"filename"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	SHA256      string    `json:"sha256"`
+}
+
+// AssetToProto converts an Asset struct into a generated proto counterpart.
+func AssetToProto(a *Asset) *gen.Asset {
+	return &gen.Asset{
+		Kind:        string(a.Kind),
+		Filename:    a.Filename,
+		Path:        a.Path,
+		Size:        a.Size,
+		ContentType: a.ContentType,
+		Sha256:      a.SHA256,
+	}
+}
+
+// AssetFromProto converts a generated proto counterpart into an Asset struct.
+func AssetFromProto(a *gen.Asset) *Asset {
+	return &Asset{
+		Kind:        AssetKind(a.Kind),
+		Filename:    a.Filename,
+		Path:        a.Path,
+		Size:        a.Size,
+		ContentType: a.ContentType,
+		SHA256:      a.Sha256,
+	}
+}
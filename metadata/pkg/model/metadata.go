@@ -4,29 +4,43 @@ import "mmoviecom/gen"
 
 // Metadata defines the movie metadata.
 type Metadata struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Director    string `json:"director"`
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Director    string  `json:"director"`
+	Poster      string  `json:"poster,omitempty"`
+	Assets      []Asset `json:"assets,omitempty"`
 }
 
 // MetadataToProto converts a Metadata struct into a
 // generated proto counterpart.
 func MetadataToProto(m *Metadata) *gen.Metadata {
+	var assets []*gen.Asset
+	for i := range m.Assets {
+		assets = append(assets, AssetToProto(&m.Assets[i]))
+	}
 	return &gen.Metadata{
 		Id:          m.ID,
 		Title:       m.Title,
 		Description: m.Description,
 		Director:    m.Director,
+		Poster:      m.Poster,
+		Assets:      assets,
 	}
 }
 
 // MetadataFromProto converts a generated proto counterpart into a Metadata struct.
 func MetadataFromProto(m *gen.Metadata) *Metadata {
+	var assets []Asset
+	for _, a := range m.Assets {
+		assets = append(assets, *AssetFromProto(a))
+	}
 	return &Metadata{
 		ID:          m.Id,
 		Title:       m.Title,
 		Description: m.Description,
 		Director:    m.Director,
+		Poster:      m.Poster,
+		Assets:      assets,
 	}
 }
@@ -26,19 +26,27 @@ func TestProtobufConversion(t *testing.T) {
 				Title:       "title",
 				Description: "description",
 				Director:    "director",
+				Poster:      "poster.jpg",
+				Assets: []Asset{
+					{Kind: AssetKindTrailer, Filename: "trailer.mp4", Path: "id/trailer/trailer.mp4", Size: 1, ContentType: "video/mp4", SHA256: "checksum"},
+				},
 			}
 			genModel := gen.Metadata{
 				Id:          "id",
 				Title:       "title",
 				Description: "description",
 				Director:    "director",
+				Poster:      "poster.jpg",
+				Assets: []*gen.Asset{
+					{Kind: "trailer", Filename: "trailer.mp4", Path: "id/trailer/trailer.mp4", Size: 1, ContentType: "video/mp4", Sha256: "checksum"},
+				},
 			}
 
 			m2p := MetadataToProto(&model)
 			p2m := MetadataFromProto(&genModel)
-			m2pDiff := cmp.Diff(m2p, &genModel, cmpopts.IgnoreUnexported(gen.Metadata{}, Metadata{}))
+			m2pDiff := cmp.Diff(m2p, &genModel, cmpopts.IgnoreUnexported(gen.Metadata{}, gen.Asset{}, Metadata{}))
 			assert.Equal(t, "", m2pDiff, tt.name)
-			p2mDiff := cmp.Diff(p2m, &model, cmpopts.IgnoreUnexported(gen.Metadata{}, Metadata{}))
+			p2mDiff := cmp.Diff(p2m, &model, cmpopts.IgnoreUnexported(gen.Metadata{}, gen.Asset{}, Metadata{}))
 			assert.Equal(t, "", p2mDiff, tt.name)
 		})
 	}
@@ -7,16 +7,23 @@ import (
 	"mmoviecom/internal/grpcutil"
 	"mmoviecom/movie/configs"
 	"mmoviecom/movie/internal/controller/movie"
+	authgateway "mmoviecom/movie/internal/gateway/auth/grpc"
 	metadatagateway "mmoviecom/movie/internal/gateway/metadata/grpc"
 	ratinggateway "mmoviecom/movie/internal/gateway/rating/grpc"
 	moviegrpchandler "mmoviecom/movie/internal/handler/grpc"
 	consullock "mmoviecom/movie/internal/lock/consul"
 	"mmoviecom/movie/internal/processor"
+	localstorage "mmoviecom/movie/internal/storage/local"
+	memorystorage "mmoviecom/movie/internal/storage/memory"
+	"mmoviecom/movie/internal/upload"
+	"mmoviecom/pkg/breaker"
 	"mmoviecom/pkg/discovery"
 	"mmoviecom/pkg/discovery/consul"
+	"mmoviecom/pkg/hedge"
 	"mmoviecom/pkg/limiter"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
+	"mmoviecom/pkg/retry"
 	"mmoviecom/pkg/tracing"
 	"net"
 	"os"
@@ -117,11 +124,6 @@ func main() {
 		}
 	}()
 
-	creds := grpcutil.GetX509Credentials("cert.crt", "cert.key")
-	metadataGateway := metadatagateway.New(registry, creds, log)
-	ratingGateway := ratinggateway.New(registry, creds, log)
-	svc := movie.New(ratingGateway, metadataGateway, log)
-
 	scope, closer := metrics.NewMetricsReporter(log, serviceName, cfg.Prometheus.MetricsPort)
 	defer func() {
 		if err := closer.Close(); err != nil {
@@ -129,7 +131,56 @@ func main() {
 		}
 	}()
 
-	h := moviegrpchandler.New(svc, log, scope)
+	creds := grpcutil.GetX509Credentials("cert.crt", "cert.key")
+	pool, err := grpcutil.NewConnPool(registry, creds, cfg.LoadBalancing)
+	if err != nil {
+		log.Fatal("Failed to create gRPC connection pool", zap.Error(err))
+	}
+	defer func() {
+		if err := pool.Close(); err != nil {
+			log.Warn("Failed to close gRPC connections", zap.Error(err))
+		}
+	}()
+	metadataGateway := metadatagateway.New(
+		pool,
+		breaker.New("metadata", cfg.CircuitBreaker, log, scope),
+		retry.New("metadata", cfg.Retry["metadata"], log, scope),
+		hedge.New("metadata", cfg.Hedging["metadata"], log, scope),
+		log,
+	)
+	ratingGateway := ratinggateway.New(
+		pool,
+		breaker.New("rating", cfg.CircuitBreaker, log, scope),
+		retry.New("rating", cfg.Retry["rating"], log, scope),
+		hedge.New("rating", cfg.Hedging["rating"], log, scope),
+		log,
+	)
+	authGateway := authgateway.New(pool, breaker.New("auth", cfg.CircuitBreaker, log, scope), retry.New("auth", cfg.Retry["auth"], log, scope), log)
+	svc := movie.New(ratingGateway, metadataGateway, authGateway, cfg.Timeouts, cfg.Cache, log, scope)
+
+	var h *moviegrpchandler.Handler
+	switch cfg.Storage.Type {
+	case "memory":
+		fileStorage := memorystorage.New(cfg.Storage.MaxSize, log)
+		uploads := upload.New(fileStorage, cfg.Storage.MaxSize, cfg.Storage.UploadTTL, log)
+		go uploads.Run(ctx)
+		h = moviegrpchandler.New(svc, fileStorage, uploads, log, scope)
+	case "local", "":
+		fileStorage, err := localstorage.New(cfg.Storage.Root, cfg.Storage.MaxSize, log)
+		if err != nil {
+			log.Fatal("Failed to create file storage", zap.Error(err))
+		}
+		defer func() {
+			if err := fileStorage.Close(); err != nil {
+				log.Warn("Failed to close file storage", zap.Error(err))
+			}
+		}()
+		uploads := upload.New(fileStorage, cfg.Storage.MaxSize, cfg.Storage.UploadTTL, log)
+		go uploads.Run(ctx)
+		h = moviegrpchandler.New(svc, fileStorage, uploads, log, scope)
+	default:
+		log.Fatal("Unsupported file storage type", zap.String("type", cfg.Storage.Type))
+	}
 
 	lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", cfg.API.Port))
 	if err != nil {
@@ -1,10 +1,25 @@
 package configs
 
+import (
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/hedge"
+	"mmoviecom/pkg/lb"
+	"mmoviecom/pkg/retry"
+	"time"
+)
+
 type ServiceConfig struct {
-	API              apiConfig              `yaml:"api"`
-	ServiceDiscovery serviceDiscoveryConfig `yaml:"serviceDiscovery"`
-	Jaeger           jaegerConfig           `yaml:"jaeger"`
-	Prometheus       prometheusConfig       `yaml:"prometheus"`
+	API              apiConfig               `yaml:"api"`
+	ServiceDiscovery serviceDiscoveryConfig  `yaml:"serviceDiscovery"`
+	Timeouts         TimeoutsConfig          `yaml:"timeouts"`
+	Cache            CacheConfig             `yaml:"cache"`
+	CircuitBreaker   breaker.Config          `yaml:"circuitBreaker"`
+	LoadBalancing    map[string]lb.Policy    `yaml:"loadBalancing"`
+	Retry            map[string]retry.Config `yaml:"retry"`
+	Hedging          map[string]hedge.Config `yaml:"hedging"`
+	Storage          StorageConfig           `yaml:"storage"`
+	Jaeger           jaegerConfig            `yaml:"jaeger"`
+	Prometheus       prometheusConfig        `yaml:"prometheus"`
 }
 
 type apiConfig struct {
@@ -18,6 +33,38 @@ type consulConfig struct {
 	Address string `yaml:"address"`
 }
 
+// TimeoutsConfig defines deadlines of calls to dependencies.
+type TimeoutsConfig struct {
+	Metadata time.Duration `yaml:"metadata" default:"1s"`
+	Rating   time.Duration `yaml:"rating" default:"500ms"`
+}
+
+// CacheConfig defines the movie details cache. Metadata and ratings
+// are cached separately, a zero TTL disables caching of the part.
+type CacheConfig struct {
+	Metadata   CacheTTLConfig `yaml:"metadata"`
+	Rating     CacheTTLConfig `yaml:"rating"`
+	MaxEntries int            `yaml:"maxEntries"`
+}
+
+// CacheTTLConfig defines how long cached values are fresh and how long
+// after that stale values are served while they are refreshed.
+type CacheTTLConfig struct {
+	TTL      time.Duration `yaml:"ttl"`
+	StaleTTL time.Duration `yaml:"staleTTL"`
+}
+
+// StorageConfig defines the storage of uploaded files. Type is local,
+// storing files in the Root directory, or memory. Files larger than
+// MaxSize bytes are rejected. Resumable uploads expire after UploadTTL
+// without writes, uploads interrupted by a restart are discarded.
+type StorageConfig struct {
+	Type      string        `yaml:"type" default:"local"`
+	Root      string        `yaml:"root"`
+	MaxSize   int64         `yaml:"maxSize"`
+	UploadTTL time.Duration `yaml:"uploadTTL"`
+}
+
 type jaegerConfig struct {
 	URL string `yaml:"url"`
 }
@@ -0,0 +1,201 @@
+// Package cache provides an in-memory cache of movie service responses.
+package cache
+
+import (
+	"context"
+	"mmoviecom/pkg/logging"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+// LoadFunc loads the value of a key on a cache miss or refresh.
+type LoadFunc[V any] func(ctx context.Context) (V, error)
+
+// Cache defines an in-memory cache with stale-while-revalidate refreshes.
+// Values are fresh for ttl after loading. Stale values are served for
+// another staleTTL while they are refreshed in the background, after
+// that they expire and are loaded synchronously. Concurrent misses of a key
+// share a single load. Load errors are not cached.
+type Cache[V any] struct {
+	sync.Mutex
+	entries    map[string]*entry[V]
+	loads      map[string]*call[V]
+	ttl        time.Duration
+	staleTTL   time.Duration
+	maxEntries int
+	now        func() time.Time
+	logger     *zap.Logger
+	metrics    metrics
+}
+
+type entry[V any] struct {
+	value      V
+	loadedAt   time.Time
+	refreshing bool
+}
+
+// call defines a load of a missing key shared by concurrent misses.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type metrics struct {
+	hits          tally.Counter
+	staleHits     tally.Counter
+	misses        tally.Counter
+	refreshErrors tally.Counter
+	evictions     tally.Counter
+}
+
+// New creates a new cache. A zero ttl disables caching, a non-positive
+// maxEntries does not limit the number of entries.
+func New[V any](name string, ttl time.Duration, staleTTL time.Duration, maxEntries int, logger *zap.Logger, scope tally.Scope) *Cache[V] {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "cache"),
+		zap.String("cache", name),
+	)
+	scope = scope.Tagged(map[string]string{
+		"component": "cache",
+		"cache":     name,
+	})
+	return &Cache[V]{
+		entries:    map[string]*entry[V]{},
+		loads:      map[string]*call[V]{},
+		ttl:        ttl,
+		staleTTL:   max(staleTTL, 0),
+		maxEntries: maxEntries,
+		now:        time.Now,
+		logger:     logger,
+		metrics: metrics{
+			hits:          scope.Counter("hits"),
+			staleHits:     scope.Counter("stale_hits"),
+			misses:        scope.Counter("misses"),
+			refreshErrors: scope.Counter("refresh_errors"),
+			evictions:     scope.Counter("evictions"),
+		},
+	}
+}
+
+// Get returns the cached value of a key. Stale values are returned as is and
+// refreshed with load in the background. Missing and expired values are loaded
+// with load before returning, callers missing a key that is being loaded wait
+// for that load instead.
+func (c *Cache[V]) Get(ctx context.Context, key string, load LoadFunc[V]) (V, error) {
+	if c.ttl <= 0 {
+		return load(ctx)
+	}
+	c.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		age := c.now().Sub(e.loadedAt)
+		switch {
+		case age < c.ttl:
+			c.Unlock()
+			c.metrics.hits.Inc(1)
+			return e.value, nil
+		case age < c.ttl+c.staleTTL:
+			value := e.value
+			if !e.refreshing {
+				e.refreshing = true
+				go c.refresh(context.WithoutCancel(ctx), key, e, load)
+			}
+			c.Unlock()
+			c.metrics.staleHits.Inc(1)
+			return value, nil
+		}
+	}
+	cl, loading := c.loads[key]
+	if !loading {
+		cl = &call[V]{done: make(chan struct{})}
+		c.loads[key] = cl
+	}
+	c.Unlock()
+
+	c.metrics.misses.Inc(1)
+	if loading {
+		select {
+		case <-cl.done:
+			return cl.value, cl.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+	cl.value, cl.err = load(ctx)
+	c.Lock()
+	// Skip values of loads started before the key was deleted,
+	// they may be outdated.
+	if c.loads[key] == cl {
+		delete(c.loads, key)
+		if cl.err == nil {
+			c.put(key, cl.value)
+		}
+	}
+	c.Unlock()
+	close(cl.done)
+	return cl.value, cl.err
+}
+
+// Delete removes a key from the cache. Values of loads of the key
+// in progress are not cached.
+func (c *Cache[V]) Delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, key)
+	delete(c.loads, key)
+}
+
+func (c *Cache[V]) refresh(ctx context.Context, key string, stale *entry[V], load LoadFunc[V]) {
+	value, err := load(ctx)
+	if err != nil {
+		c.metrics.refreshErrors.Inc(1)
+		c.logger.Warn("Failed to refresh cache entry", zap.String("key", key), zap.Error(err))
+		c.Lock()
+		stale.refreshing = false
+		c.Unlock()
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	// Skip entries deleted or replaced during the refresh.
+	if c.entries[key] == stale {
+		c.entries[key] = &entry[V]{value: value, loadedAt: c.now()}
+	}
+}
+
+// put stores a loaded value. Callers must hold the cache lock.
+func (c *Cache[V]) put(key string, value V) {
+	if _, ok := c.entries[key]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = &entry[V]{value: value, loadedAt: c.now()}
+}
+
+// evict removes the expired entries or, if there are none, the oldest entry.
+// Callers must hold the cache lock.
+func (c *Cache[V]) evict() {
+	now := c.now()
+	var oldestKey string
+	var oldest *entry[V]
+	evicted := 0
+	for key, e := range c.entries {
+		if now.Sub(e.loadedAt) >= c.ttl+c.staleTTL {
+			delete(c.entries, key)
+			evicted++
+			continue
+		}
+		if oldest == nil || e.loadedAt.Before(oldest.loadedAt) {
+			oldestKey, oldest = key, e
+		}
+	}
+	if evicted == 0 && oldest != nil {
+		delete(c.entries, oldestKey)
+		evicted++
+	}
+	c.metrics.evictions.Inc(int64(evicted))
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+func TestCacheGet(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := New[int]("test", time.Minute, time.Hour, 0, zap.NewNop(), tally.NoopScope)
+	c.now = func() time.Time { return now }
+	loads := 0
+	load := func(value int, err error) LoadFunc[int] {
+		return func(context.Context) (int, error) {
+			loads++
+			return value, err
+		}
+	}
+
+	_, err := c.Get(ctx, "key", load(0, errors.New("unavailable")))
+	assert.Error(t, err)
+	v, err := c.Get(ctx, "key", load(1, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, loads, "errors are not cached")
+
+	now = now.Add(30 * time.Second)
+	v, err = c.Get(ctx, "key", load(2, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v, "fresh value")
+	assert.Equal(t, 2, loads)
+
+	now = now.Add(2 * time.Hour)
+	v, err = c.Get(ctx, "key", load(3, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v, "expired value")
+	assert.Equal(t, 3, loads)
+
+	c.Delete("key")
+	v, err = c.Get(ctx, "key", load(4, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, v, "deleted value")
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := New[int]("test", time.Minute, time.Hour, 0, zap.NewNop(), tally.NoopScope)
+	c.now = func() time.Time { return now }
+	_, err := c.Get(ctx, "key", func(context.Context) (int, error) { return 1, nil })
+	assert.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	refreshed := make(chan struct{})
+	release := make(chan struct{})
+	refresh := func(context.Context) (int, error) {
+		<-release
+		defer close(refreshed)
+		return 2, nil
+	}
+	for range 2 {
+		v, err := c.Get(ctx, "key", refresh)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v, "stale value is served during the refresh")
+	}
+	close(release)
+	<-refreshed
+
+	assert.Eventually(t, func() bool {
+		v, err := c.Get(ctx, "key", func(context.Context) (int, error) { return 3, nil })
+		return err == nil && v == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := New[string]("test", time.Minute, 0, 2, zap.NewNop(), tally.NoopScope)
+	c.now = func() time.Time { return now }
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := c.Get(ctx, key, func(context.Context) (string, error) { return key, nil })
+		assert.NoError(t, err)
+		now = now.Add(time.Second)
+	}
+	assert.Len(t, c.entries, 2)
+	assert.NotContains(t, c.entries, "a", "the oldest entry is evicted")
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := New[int]("test", 0, 0, 0, zap.NewNop(), tally.NoopScope)
+	loads := 0
+	for range 2 {
+		_, err := c.Get(context.Background(), "key", func(context.Context) (int, error) {
+			loads++
+			return loads, nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, loads)
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	ctx := context.Background()
+	c := New[int]("test", time.Minute, 0, 0, zap.NewNop(), tally.NoopScope)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 1, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get(ctx, "key", load)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, v)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		c.Lock()
+		defer c.Unlock()
+		return c.loads["key"] != nil
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load(), "concurrent misses share a load")
+}
+
+func TestCacheDeleteDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	c := New[int]("test", time.Minute, time.Hour, 0, zap.NewNop(), tally.NoopScope)
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := c.Get(ctx, "key", func(context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}()
+	<-started
+	c.Delete("key")
+	close(release)
+	<-done
+
+	v, err := c.Get(ctx, "key", func(context.Context) (int, error) { return 2, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v, "values loaded before a deletion are not cached")
+}
@@ -4,70 +4,469 @@ import (
 	"context"
 	"errors"
 	metadatamodel "mmoviecom/metadata/pkg/model"
-	"mmoviecom/movie/internal/gateway"
+	"mmoviecom/movie/configs"
+	"mmoviecom/movie/internal/cache"
 	"mmoviecom/movie/pkg/model"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	ratingmodel "mmoviecom/rating/pkg/model"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // ErrNotFound is returned when the movie metadata not found.
-var ErrNotFound = errors.New("movie metadata not found")
+var ErrNotFound = errs.NotFound("movie metadata not found")
+
+// ErrTokenIsEmpty is returned when a request has no token.
+var ErrTokenIsEmpty = errs.Unauthenticated("token is empty")
+
+// ErrAlreadyExists is returned when creating a movie with an existing id.
+var ErrAlreadyExists = errs.AlreadyExists("movie already exists")
+
+// ErrInvalidMetadata is returned when the movie metadata is incomplete.
+var ErrInvalidMetadata = errs.InvalidArgument("movie id and title are required")
+
+// ErrInvalidSortOrder is returned when a movie list sort order is unknown.
+var ErrInvalidSortOrder = errs.InvalidArgument("invalid sort order")
+
+// ErrInvalidAsset is returned when a movie asset kind is unsupported.
+var ErrInvalidAsset = errs.InvalidArgument("unsupported asset kind")
+
+// Movie list sort orders.
+const (
+	SortByTitle  = "title"
+	SortByRating = "rating"
+)
+
+// Movie list page sizes.
+const (
+	DefaultListPageSize = 20
+	MaxListPageSize     = 100
+)
+
+// MaxListScanPages defines the maximum number of metadata pages read
+// by a single request listing movies by title with a minimum rating.
+const MaxListScanPages = 10
 
 type ratingGateway interface {
 	GetAggregatedRating(ctx context.Context, recordId ratingmodel.RecordId, recordType ratingmodel.RecordType) (float64, error)
+	GetAggregatedRatings(ctx context.Context, recordIds []ratingmodel.RecordId, recordType ratingmodel.RecordType) (map[ratingmodel.RecordId]float64, error)
+	GetTopRated(ctx context.Context, recordType ratingmodel.RecordType, minVotes int, offset int, pageSize int) ([]ratingmodel.RecordAggregate, int, error)
 	PutRating(ctx context.Context, recordId ratingmodel.RecordId, recordType ratingmodel.RecordType, rating *ratingmodel.Rating, token string) error
 }
 
+type authGateway interface {
+	ValidateToken(ctx context.Context, token string) (string, error)
+}
+
 type metadataGateway interface {
 	Get(ctx context.Context, id string) (*metadatamodel.Metadata, error)
 	Put(ctx context.Context, metadata *metadatamodel.Metadata) error
+	Create(ctx context.Context, metadata *metadatamodel.Metadata) error
+	List(ctx context.Context, offset int, pageSize int) ([]metadatamodel.Metadata, int, error)
+	PutAsset(ctx context.Context, id string, asset *metadatamodel.Asset) error
 }
 
 // Controller defines a movie service controller.
 type Controller struct {
 	ratingGateway   ratingGateway
 	metadataGateway metadataGateway
+	authGateway     authGateway
+	timeouts        configs.TimeoutsConfig
+	metadataCache   *cache.Cache[*metadatamodel.Metadata]
+	ratingCache     *cache.Cache[*float64]
 	logger          *zap.Logger
+	degraded        tally.Counter
+	maxScanPages    int
 }
 
-// New creates a movie service controller.
-func New(gateway ratingGateway, metadataGateway metadataGateway, logger *zap.Logger) *Controller {
+// New creates a movie service controller. Calls to the dependencies are
+// limited by the timeouts, zero timeouts are not limited. Movie details
+// parts are cached according to the cache configuration.
+func New(gateway ratingGateway, metadataGateway metadataGateway, authGateway authGateway, timeouts configs.TimeoutsConfig, cacheCfg configs.CacheConfig, logger *zap.Logger, scope tally.Scope) *Controller {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "controller"),
 	)
-	return &Controller{gateway, metadataGateway, logger}
+	scope = scope.Tagged(map[string]string{
+		"component": "controller",
+	})
+	return &Controller{
+		ratingGateway:   gateway,
+		metadataGateway: metadataGateway,
+		authGateway:     authGateway,
+		timeouts:        timeouts,
+		metadataCache:   cache.New[*metadatamodel.Metadata]("metadata", cacheCfg.Metadata.TTL, cacheCfg.Metadata.StaleTTL, cacheCfg.MaxEntries, logger, scope),
+		ratingCache:     cache.New[*float64]("rating", cacheCfg.Rating.TTL, cacheCfg.Rating.StaleTTL, cacheCfg.MaxEntries, logger, scope),
+		logger:          logger,
+		degraded:        scope.Counter("degraded_responses"),
+		maxScanPages:    MaxListScanPages,
+	}
+}
+
+// ratingResult defines the outcome of an aggregated rating request.
+type ratingResult struct {
+	rating *float64
+	err    error
 }
 
 // Get returns the movie details including the aggregated rating and movie metadata.
+// The metadata and the rating are fetched concurrently, or served from the
+// cache. If the rating service fails, the details are returned without the
+// rating and marked as degraded.
 func (c *Controller) Get(ctx context.Context, id string) (*model.MovieDetails, error) {
-	c.logger.Debug("Trying to get metadata from gateway", zap.String("id", id))
-	metadata, err := c.metadataGateway.Get(ctx, id)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ratingCh := make(chan ratingResult, 1)
+	go func() {
+		ratingCh <- c.getRating(ctx, id)
+	}()
+
+	metadata, err := c.getCachedMetadata(ctx, id)
 	if err != nil {
-		c.logger.Warn("Failed to get metadata from gateway", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+	details := &model.MovieDetails{Metadata: *metadata}
+
+	res := <-ratingCh
+	if res.err != nil {
+		c.logger.Warn("Failed to get rating from gateway, returning degraded details", zap.String("id", id), zap.Error(res.err))
+		c.degraded.Inc(1)
+		details.Degraded = true
+		return details, nil
+	}
+	details.Rating = res.rating
+	return details, nil
+}
+
+// ListMovies returns a page of movie details sorted by title or by aggregated
+// rating, and the offset of the next page or 0 if there are no more movies.
+// Movies sorted by title are paged by the metadata service, movies sorted by
+// rating are paged by the rating service, and only rated movies are listed.
+// If minRating is positive, only movies rated at least minRating are listed
+// and a page may be shorter than pageSize, or even empty, while there are
+// more movies to scan.
+// If the rating service fails while listing by title without a minimum
+// rating, the movies are returned without ratings and marked as degraded.
+func (c *Controller) ListMovies(ctx context.Context, sortBy string, minRating float64, offset int, pageSize int) ([]model.MovieDetails, int, error) {
+	if sortBy == "" {
+		sortBy = SortByTitle
+	}
+	if sortBy != SortByTitle && sortBy != SortByRating {
+		return nil, 0, ErrInvalidSortOrder
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+	pageSize = min(pageSize, MaxListPageSize)
+	offset = max(offset, 0)
+	if sortBy == SortByRating {
+		return c.listByRating(ctx, minRating, offset, pageSize)
+	}
+	return c.listByTitle(ctx, minRating, offset, pageSize)
+}
+
+// listByTitle returns a page of movie details sorted by title. Without
+// a minimum rating it reads a single page of metadata, otherwise it reads
+// pages until the movies rated at least minRating fill the page or
+// maxScanPages pages are read, and the scan continues from the next offset.
+func (c *Controller) listByTitle(ctx context.Context, minRating float64, offset int, pageSize int) ([]model.MovieDetails, int, error) {
+	var res []model.MovieDetails
+	for pages := 1; ; pages++ {
+		metadataCtx, metadataCancel := withTimeout(ctx, c.timeouts.Metadata)
+		page, next, err := c.metadataGateway.List(metadataCtx, offset, pageSize)
+		metadataCancel()
+		if err != nil {
+			c.logger.Warn("Failed to list metadata from gateway", zap.Int("offset", offset), zap.Error(err))
+			return nil, 0, err
+		}
+		ratings, err := c.getRatings(ctx, page)
+		degraded := false
+		if err != nil && minRating > 0 {
+			return nil, 0, err
+		} else if err != nil {
+			c.logger.Warn("Failed to get ratings from gateway, returning degraded movies", zap.Error(err))
+			c.degraded.Inc(1)
+			degraded = true
+		}
+		for i, m := range page {
+			details := model.MovieDetails{Metadata: m, Degraded: degraded}
+			if rating, ok := ratings[ratingmodel.RecordId(m.ID)]; ok {
+				details.Rating = &rating
+			}
+			if minRating > 0 && (details.Rating == nil || *details.Rating < minRating) {
+				continue
+			}
+			res = append(res, details)
+			if len(res) == pageSize && (i+1 < len(page) || next != 0) {
+				return res, offset + i + 1, nil
+			}
+		}
+		if next == 0 || pages >= c.maxScanPages {
+			return res, next, nil
+		}
+		offset = next
+	}
+}
+
+// listByRating returns a page of rated movie details sorted by aggregated
+// rating. Only the metadata of the movies in the page is read, movies
+// without metadata are skipped.
+func (c *Controller) listByRating(ctx context.Context, minRating float64, offset int, pageSize int) ([]model.MovieDetails, int, error) {
+	ratingCtx, ratingCancel := withTimeout(ctx, c.timeouts.Rating)
+	records, next, err := c.ratingGateway.GetTopRated(ratingCtx, ratingmodel.RecordTypeMovie, 0, offset, pageSize)
+	ratingCancel()
+	if err != nil {
+		c.logger.Warn("Failed to get top rated movies from gateway", zap.Int("offset", offset), zap.Error(err))
+		return nil, 0, err
+	}
+	if i := slices.IndexFunc(records, func(r ratingmodel.RecordAggregate) bool { return r.Rating < minRating }); i >= 0 {
+		records, next = records[:i], 0
+	}
+
+	metadata := make([]*metadatamodel.Metadata, len(records))
+	metadataErrs := make([]error, len(records))
+	var wg sync.WaitGroup
+	for i, r := range records {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metadata[i], metadataErrs[i] = c.getCachedMetadata(ctx, string(r.RecordId))
+		}()
+	}
+	wg.Wait()
+
+	res := make([]model.MovieDetails, 0, len(records))
+	for i, r := range records {
+		if errors.Is(metadataErrs[i], ErrNotFound) {
+			continue
+		} else if metadataErrs[i] != nil {
+			return nil, 0, metadataErrs[i]
+		}
+		rating := r.Rating
+		res = append(res, model.MovieDetails{Metadata: *metadata[i], Rating: &rating})
+	}
+	return res, next, nil
+}
+
+// getRatings returns the aggregated ratings of movies.
+// Movies without ratings are omitted.
+func (c *Controller) getRatings(ctx context.Context, metadata []metadatamodel.Metadata) (map[ratingmodel.RecordId]float64, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	ids := make([]ratingmodel.RecordId, 0, len(metadata))
+	for _, m := range metadata {
+		ids = append(ids, ratingmodel.RecordId(m.ID))
+	}
+	ratingCtx, ratingCancel := withTimeout(ctx, c.timeouts.Rating)
+	defer ratingCancel()
+	return c.ratingGateway.GetAggregatedRatings(ratingCtx, ids, ratingmodel.RecordTypeMovie)
+}
+
+// RateMovie writes a rating of a movie by the user of the token and returns
+// the updated aggregated rating of the movie.
+func (c *Controller) RateMovie(ctx context.Context, id string, value ratingmodel.RatingValue, token string) (float64, error) {
+	user, err := c.validateToken(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := c.getMetadata(ctx, id); err != nil {
+		return 0, err
+	}
+
+	rating := &ratingmodel.Rating{
+		RecordId:   id,
+		RecordType: string(ratingmodel.RecordTypeMovie),
+		UserId:     ratingmodel.UserId(user),
+		Value:      value,
+	}
+	ratingCtx, ratingCancel := withTimeout(ctx, c.timeouts.Rating)
+	defer ratingCancel()
+	if err := c.ratingGateway.PutRating(ratingCtx, ratingmodel.RecordId(id), ratingmodel.RecordTypeMovie, rating, token); err != nil {
+		c.logger.Warn("Failed to put rating to gateway", zap.String("id", id), zap.Error(err))
+		return 0, err
+	}
+	c.ratingCache.Delete(id)
+	return c.ratingGateway.GetAggregatedRating(ratingCtx, ratingmodel.RecordId(id), ratingmodel.RecordTypeMovie)
+}
+
+// CreateMovie stores the metadata of a new movie on behalf of the user of
+// the token and returns its details. If poster is not empty, it is attached
+// to the movie. The metadata service rejects existing movies atomically.
+func (c *Controller) CreateMovie(ctx context.Context, metadata *metadatamodel.Metadata, poster string, token string) (*model.MovieDetails, error) {
+	if _, err := c.validateToken(ctx, token); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
+	}
+	m := *metadata
+	m.Poster = poster
+	metadataCtx, cancel := withTimeout(ctx, c.timeouts.Metadata)
+	defer cancel()
+	err := c.metadataGateway.Create(metadataCtx, &m)
+	if err != nil && errors.Is(err, errs.ErrAlreadyExists) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		c.logger.Warn("Failed to create metadata in gateway", zap.String("id", m.ID), zap.Error(err))
+		return nil, err
+	}
+	c.metadataCache.Delete(m.ID)
+	return c.Get(ctx, m.ID)
+}
+
+// UpdateMovie replaces the metadata of an existing movie on behalf of the
+// user of the token and returns its details. If poster is empty, the current
+// poster of the movie is kept.
+func (c *Controller) UpdateMovie(ctx context.Context, metadata *metadatamodel.Metadata, poster string, token string) (*model.MovieDetails, error) {
+	if _, err := c.validateToken(ctx, token); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
+	}
+	current, err := c.getMetadata(ctx, metadata.ID)
+	if err != nil {
+		return nil, err
+	}
+	m := *metadata
+	m.Poster = current.Poster
+	if poster != "" {
+		m.Poster = poster
+	}
+	if err := c.putMetadata(ctx, &m); err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, m.ID)
+}
+
+// ValidateToken checks that a request has a valid token.
+func (c *Controller) ValidateToken(ctx context.Context, token string) error {
+	_, err := c.validateToken(ctx, token)
+	return err
+}
+
+// validateToken returns the user of a token.
+func (c *Controller) validateToken(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrTokenIsEmpty
+	}
+	user, err := c.authGateway.ValidateToken(ctx, token)
+	if err != nil {
+		c.logger.Warn("Failed to validate token", zap.Error(err))
+		return "", err
+	}
+	return user, nil
+}
+
+// ValidateAsset checks that an asset can be attached to a movie before
+// its file is stored.
+func (c *Controller) ValidateAsset(ctx context.Context, id string, kind metadatamodel.AssetKind) error {
+	if err := kind.Validate(); err != nil {
+		return ErrInvalidAsset
+	}
+	_, err := c.getMetadata(ctx, id)
+	return err
+}
+
+// AttachAsset links a stored asset to an existing movie. A movie keeps one
+// asset per kind and file name, attaching it again replaces the record.
+func (c *Controller) AttachAsset(ctx context.Context, id string, asset *metadatamodel.Asset) error {
+	if err := asset.Kind.Validate(); err != nil {
+		return ErrInvalidAsset
+	}
+	metadataCtx, cancel := withTimeout(ctx, c.timeouts.Metadata)
+	defer cancel()
+	err := c.metadataGateway.PutAsset(metadataCtx, id, asset)
+	if err != nil && errors.Is(err, errs.ErrNotFound) {
+		return ErrNotFound
+	} else if err != nil {
+		c.logger.Warn("Failed to put asset to gateway", zap.String("id", id), zap.Error(err))
+		return err
 	}
+	c.metadataCache.Delete(id)
+	return nil
+}
+
+func validateMetadata(metadata *metadatamodel.Metadata) error {
+	if metadata == nil || metadata.ID == "" || metadata.Title == "" {
+		return ErrInvalidMetadata
+	}
+	return nil
+}
 
-	if err != nil && errors.Is(err, gateway.ErrNotFound) {
+// getMetadata returns the metadata of a movie or ErrNotFound if there is none.
+func (c *Controller) getMetadata(ctx context.Context, id string) (*metadatamodel.Metadata, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Metadata)
+	defer cancel()
+	metadata, err := c.metadataGateway.Get(ctx, id)
+	if err != nil && errors.Is(err, errs.ErrNotFound) {
 		return nil, ErrNotFound
 	} else if err != nil {
+		c.logger.Warn("Failed to get metadata from gateway", zap.String("id", id), zap.Error(err))
 		return nil, err
 	}
-	details := &model.MovieDetails{Metadata: *metadata}
+	return metadata, nil
+}
 
-	c.logger.Debug("Trying to get rating from gateway", zap.String("id", id))
-	rating, err := c.ratingGateway.GetAggregatedRating(ctx, ratingmodel.RecordId(id), ratingmodel.RecordTypeMovie)
-	if err != nil && errors.Is(err, errors.New("rating not found for a record")) {
-		// ok
-	} else if err != nil && errors.Is(err, status.Errorf(codes.NotFound, "rating not found for a record")) {
-		// ok
+// getCachedMetadata returns the metadata of a movie from the cache or
+// the gateway, or ErrNotFound if there is none.
+func (c *Controller) getCachedMetadata(ctx context.Context, id string) (*metadatamodel.Metadata, error) {
+	metadata, err := c.metadataCache.Get(ctx, id, func(ctx context.Context) (*metadatamodel.Metadata, error) {
+		c.logger.Debug("Trying to get metadata from gateway", zap.String("id", id))
+		ctx, cancel := withTimeout(ctx, c.timeouts.Metadata)
+		defer cancel()
+		return c.metadataGateway.Get(ctx, id)
+	})
+	if err != nil {
+		c.logger.Warn("Failed to get metadata from gateway", zap.String("id", id), zap.Error(err))
+	}
+	if err != nil && errors.Is(err, errs.ErrNotFound) {
+		return nil, ErrNotFound
 	} else if err != nil {
-		c.logger.Warn("Failed to get rating from gateway", zap.String("id", id), zap.Error(err))
 		return nil, err
-	} else {
-		details.Rating = &rating
 	}
-	return details, nil
+	return metadata, nil
+}
+
+func (c *Controller) putMetadata(ctx context.Context, metadata *metadatamodel.Metadata) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Metadata)
+	defer cancel()
+	if err := c.metadataGateway.Put(ctx, metadata); err != nil {
+		c.logger.Warn("Failed to put metadata to gateway", zap.String("id", metadata.ID), zap.Error(err))
+		return err
+	}
+	c.metadataCache.Delete(metadata.ID)
+	return nil
+}
+
+// getRating returns the aggregated rating of a movie, or a nil rating if there are no ratings.
+func (c *Controller) getRating(ctx context.Context, id string) ratingResult {
+	rating, err := c.ratingCache.Get(ctx, id, func(ctx context.Context) (*float64, error) {
+		c.logger.Debug("Trying to get rating from gateway", zap.String("id", id))
+		ctx, cancel := withTimeout(ctx, c.timeouts.Rating)
+		defer cancel()
+		rating, err := c.ratingGateway.GetAggregatedRating(ctx, ratingmodel.RecordId(id), ratingmodel.RecordTypeMovie)
+		if err != nil && errors.Is(err, errs.ErrNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return &rating, nil
+	})
+	return ratingResult{rating: rating, err: err}
+}
+
+// withTimeout returns a context limited by the timeout if it is positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
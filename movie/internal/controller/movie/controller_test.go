@@ -0,0 +1,572 @@
+package movie
+
+import (
+	"context"
+	"errors"
+	metadatamodel "mmoviecom/metadata/pkg/model"
+	"mmoviecom/movie/configs"
+	"mmoviecom/movie/pkg/model"
+	"mmoviecom/pkg/errs"
+	ratingmodel "mmoviecom/rating/pkg/model"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+type testRatingGateway struct {
+	rating  float64
+	ratings map[ratingmodel.RecordId]float64
+	err     error
+	delay   time.Duration
+	put     []ratingmodel.Rating
+}
+
+func (g *testRatingGateway) GetAggregatedRating(ctx context.Context, _ ratingmodel.RecordId, _ ratingmodel.RecordType) (float64, error) {
+	select {
+	case <-time.After(g.delay):
+		return g.rating, g.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (g *testRatingGateway) GetAggregatedRatings(_ context.Context, recordIds []ratingmodel.RecordId, _ ratingmodel.RecordType) (map[ratingmodel.RecordId]float64, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	res := map[ratingmodel.RecordId]float64{}
+	for _, id := range recordIds {
+		if rating, ok := g.ratings[id]; ok {
+			res[id] = rating
+		}
+	}
+	return res, nil
+}
+
+func (g *testRatingGateway) GetTopRated(_ context.Context, _ ratingmodel.RecordType, _ int, offset int, pageSize int) ([]ratingmodel.RecordAggregate, int, error) {
+	if g.err != nil {
+		return nil, 0, g.err
+	}
+	var res []ratingmodel.RecordAggregate
+	for id, rating := range g.ratings {
+		res = append(res, ratingmodel.RecordAggregate{RecordId: id, Rating: rating, Count: 1})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Rating > res[j].Rating
+	})
+	if offset+pageSize >= len(res) {
+		return res[min(offset, len(res)):], 0, nil
+	}
+	return res[offset : offset+pageSize], offset + pageSize, nil
+}
+
+func (g *testRatingGateway) PutRating(_ context.Context, _ ratingmodel.RecordId, _ ratingmodel.RecordType, rating *ratingmodel.Rating, _ string) error {
+	g.put = append(g.put, *rating)
+	g.rating = float64(rating.Value)
+	return nil
+}
+
+type testAuthGateway struct{}
+
+func (g *testAuthGateway) ValidateToken(_ context.Context, token string) (string, error) {
+	if token != "token" {
+		return "", errs.Unauthenticated("invalid token")
+	}
+	return "user", nil
+}
+
+type testMetadataGateway struct {
+	metadata *metadatamodel.Metadata
+	list     []metadatamodel.Metadata
+	err      error
+	mu       sync.Mutex
+	gets     []string
+	lists    int
+}
+
+func (g *testMetadataGateway) Get(_ context.Context, id string) (*metadatamodel.Metadata, error) {
+	g.mu.Lock()
+	g.gets = append(g.gets, id)
+	g.mu.Unlock()
+	if g.list == nil {
+		return g.metadata, g.err
+	}
+	for i := range g.list {
+		if g.list[i].ID == id {
+			return &g.list[i], g.err
+		}
+	}
+	return nil, errs.NotFound("not found")
+}
+
+func (g *testMetadataGateway) Put(_ context.Context, metadata *metadatamodel.Metadata) error {
+	g.metadata, g.err = metadata, nil
+	return nil
+}
+
+func (g *testMetadataGateway) Create(_ context.Context, metadata *metadatamodel.Metadata) error {
+	if g.metadata != nil && g.err == nil {
+		return errs.AlreadyExists("already exists")
+	}
+	g.metadata, g.err = metadata, nil
+	return nil
+}
+
+func (g *testMetadataGateway) PutAsset(_ context.Context, _ string, asset *metadatamodel.Asset) error {
+	if g.err != nil {
+		return g.err
+	}
+	m := *g.metadata
+	m.Assets = append(append([]metadatamodel.Asset{}, m.Assets...), *asset)
+	g.metadata = &m
+	return nil
+}
+
+func (g *testMetadataGateway) List(_ context.Context, offset int, pageSize int) ([]metadatamodel.Metadata, int, error) {
+	g.lists++
+	if g.err != nil {
+		return nil, 0, g.err
+	}
+	if offset+pageSize >= len(g.list) {
+		return g.list[min(offset, len(g.list)):], 0, nil
+	}
+	return g.list[offset : offset+pageSize], offset + pageSize, nil
+}
+
+func TestControllerGet(t *testing.T) {
+	metadata := &metadatamodel.Metadata{ID: "id", Title: "title"}
+	rating := 4.5
+	tests := []struct {
+		name         string
+		metadataErr  error
+		ratingGW     *testRatingGateway
+		wantRes      *model.MovieDetails
+		wantErr      error
+		wantDegraded int64
+	}{
+		{
+			name:     "success",
+			ratingGW: &testRatingGateway{rating: rating},
+			wantRes:  &model.MovieDetails{Metadata: *metadata, Rating: &rating},
+		},
+		{
+			name:        "metadata not found",
+			metadataErr: errs.NotFound("not found"),
+			ratingGW:    &testRatingGateway{rating: rating},
+			wantErr:     ErrNotFound,
+		},
+		{
+			name:     "rating not found",
+			ratingGW: &testRatingGateway{err: errs.NotFound("rating not found for a record")},
+			wantRes:  &model.MovieDetails{Metadata: *metadata},
+		},
+		{
+			name:         "rating unavailable",
+			ratingGW:     &testRatingGateway{err: errs.Unavailable("unavailable")},
+			wantRes:      &model.MovieDetails{Metadata: *metadata, Degraded: true},
+			wantDegraded: 1,
+		},
+		{
+			name:         "rating deadline exceeded",
+			ratingGW:     &testRatingGateway{rating: rating, delay: time.Second},
+			wantRes:      &model.MovieDetails{Metadata: *metadata, Degraded: true},
+			wantDegraded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := tally.NewTestScope("", nil)
+			metadataGW := &testMetadataGateway{metadata: metadata, err: tt.metadataErr}
+			if tt.metadataErr != nil {
+				metadataGW.metadata = nil
+			}
+			timeouts := configs.TimeoutsConfig{Metadata: time.Second, Rating: 10 * time.Millisecond}
+			c := New(tt.ratingGW, metadataGW, &testAuthGateway{}, timeouts, configs.CacheConfig{}, zap.NewNop(), scope)
+			res, err := c.Get(context.Background(), "id")
+			assert.Equal(t, tt.wantRes, res, tt.name)
+			assert.True(t, errors.Is(err, tt.wantErr), tt.name)
+			var degraded int64
+			for _, counter := range scope.Snapshot().Counters() {
+				if counter.Name() == "degraded_responses" {
+					degraded = counter.Value()
+				}
+			}
+			assert.Equal(t, tt.wantDegraded, degraded, tt.name)
+		})
+	}
+}
+
+func TestControllerRateMovie(t *testing.T) {
+	metadata := &metadatamodel.Metadata{ID: "id", Title: "title"}
+	tests := []struct {
+		name        string
+		token       string
+		metadataErr error
+		wantRating  float64
+		wantErr     error
+		wantPut     []ratingmodel.Rating
+	}{
+		{
+			name:       "success",
+			token:      "token",
+			wantRating: 4,
+			wantPut: []ratingmodel.Rating{
+				{RecordId: "id", RecordType: string(ratingmodel.RecordTypeMovie), UserId: "user", Value: 4},
+			},
+		},
+		{
+			name:    "empty token",
+			wantErr: errs.ErrUnauthenticated,
+		},
+		{
+			name:    "invalid token",
+			token:   "invalid",
+			wantErr: errs.ErrUnauthenticated,
+		},
+		{
+			name:        "movie not found",
+			token:       "token",
+			metadataErr: errs.NotFound("not found"),
+			wantErr:     ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratingGW := &testRatingGateway{}
+			metadataGW := &testMetadataGateway{metadata: metadata, err: tt.metadataErr}
+			c := New(ratingGW, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, configs.CacheConfig{}, zap.NewNop(), tally.NoopScope)
+			rating, err := c.RateMovie(context.Background(), "id", 4, tt.token)
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+			assert.Equal(t, tt.wantRating, rating, tt.name)
+			assert.Equal(t, tt.wantPut, ratingGW.put, tt.name)
+		})
+	}
+}
+
+func TestControllerCreateMovie(t *testing.T) {
+	existing := &metadatamodel.Metadata{ID: "id", Title: "old title"}
+	tests := []struct {
+		name     string
+		existing *metadatamodel.Metadata
+		metadata *metadatamodel.Metadata
+		poster   string
+		token    string
+		wantRes  *model.MovieDetails
+		wantErr  error
+	}{
+		{
+			name:     "success",
+			metadata: &metadatamodel.Metadata{ID: "id", Title: "title"},
+			poster:   "poster.jpg",
+			token:    "token",
+			wantRes:  &model.MovieDetails{Metadata: metadatamodel.Metadata{ID: "id", Title: "title", Poster: "poster.jpg"}},
+		},
+		{
+			name:     "empty token",
+			metadata: &metadatamodel.Metadata{ID: "id", Title: "title"},
+			wantErr:  ErrTokenIsEmpty,
+		},
+		{
+			name:     "invalid token",
+			metadata: &metadatamodel.Metadata{ID: "id", Title: "title"},
+			token:    "invalid",
+			wantErr:  errs.ErrUnauthenticated,
+		},
+		{
+			name:     "empty title",
+			metadata: &metadatamodel.Metadata{ID: "id"},
+			token:    "token",
+			wantErr:  errs.ErrInvalidArgument,
+		},
+		{
+			name:     "already exists",
+			existing: existing,
+			metadata: &metadatamodel.Metadata{ID: "id", Title: "title"},
+			token:    "token",
+			wantErr:  ErrAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadataGW := &testMetadataGateway{metadata: tt.existing}
+			if tt.existing == nil {
+				metadataGW.err = errs.NotFound("not found")
+			}
+			ratingGW := &testRatingGateway{err: errs.NotFound("not found")}
+			c := New(ratingGW, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, configs.CacheConfig{}, zap.NewNop(), tally.NoopScope)
+			res, err := c.CreateMovie(context.Background(), tt.metadata, tt.poster, tt.token)
+			assert.Equal(t, tt.wantRes, res, tt.name)
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+		})
+	}
+}
+
+func TestControllerUpdateMovie(t *testing.T) {
+	existing := &metadatamodel.Metadata{ID: "id", Title: "old title", Poster: "old.jpg"}
+	tests := []struct {
+		name     string
+		existing *metadatamodel.Metadata
+		poster   string
+		token    string
+		wantRes  *model.MovieDetails
+		wantErr  error
+	}{
+		{
+			name:     "keeps poster",
+			existing: existing,
+			token:    "token",
+			wantRes:  &model.MovieDetails{Metadata: metadatamodel.Metadata{ID: "id", Title: "title", Poster: "old.jpg"}},
+		},
+		{
+			name:     "replaces poster",
+			existing: existing,
+			poster:   "new.jpg",
+			token:    "token",
+			wantRes:  &model.MovieDetails{Metadata: metadatamodel.Metadata{ID: "id", Title: "title", Poster: "new.jpg"}},
+		},
+		{
+			name:     "empty token",
+			existing: existing,
+			wantErr:  ErrTokenIsEmpty,
+		},
+		{
+			name:     "invalid token",
+			existing: existing,
+			token:    "invalid",
+			wantErr:  errs.ErrUnauthenticated,
+		},
+		{
+			name:    "not found",
+			token:   "token",
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadataGW := &testMetadataGateway{metadata: tt.existing}
+			if tt.existing == nil {
+				metadataGW.err = errs.NotFound("not found")
+			}
+			ratingGW := &testRatingGateway{err: errs.NotFound("not found")}
+			c := New(ratingGW, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, configs.CacheConfig{}, zap.NewNop(), tally.NoopScope)
+			res, err := c.UpdateMovie(context.Background(), &metadatamodel.Metadata{ID: "id", Title: "title"}, tt.poster, tt.token)
+			assert.Equal(t, tt.wantRes, res, tt.name)
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+		})
+	}
+}
+
+func TestControllerListMovies(t *testing.T) {
+	list := []metadatamodel.Metadata{
+		{ID: "c", Title: "Alien"},
+		{ID: "a", Title: "Brazil"},
+		{ID: "e", Title: "Casablanca"},
+		{ID: "b", Title: "Dune"},
+		{ID: "d", Title: "Eraserhead"},
+	}
+	ratings := map[ratingmodel.RecordId]float64{"a": 3, "b": 5, "d": 4, "x": 4.5}
+	rated := func(i int, rating float64) model.MovieDetails {
+		return model.MovieDetails{Metadata: list[i], Rating: &rating}
+	}
+	tests := []struct {
+		name      string
+		sortBy    string
+		minRating float64
+		offset    int
+		pageSize  int
+		scanPages int
+		ratingErr error
+		wantRes   []model.MovieDetails
+		wantNext  int
+		wantErr   error
+		wantGets  []string
+		wantLists int
+	}{
+		{
+			name:      "by title",
+			pageSize:  2,
+			wantRes:   []model.MovieDetails{{Metadata: list[0]}, rated(1, 3)},
+			wantNext:  2,
+			wantLists: 1,
+		},
+		{
+			name:      "by title last page",
+			offset:    4,
+			pageSize:  2,
+			wantRes:   []model.MovieDetails{rated(4, 4)},
+			wantLists: 1,
+		},
+		{
+			name:      "min rating",
+			minRating: 4,
+			wantRes:   []model.MovieDetails{rated(3, 5), rated(4, 4)},
+			wantLists: 1,
+		},
+		{
+			name:      "min rating reads pages until filled",
+			minRating: 4,
+			pageSize:  1,
+			wantRes:   []model.MovieDetails{rated(3, 5)},
+			wantNext:  4,
+			wantLists: 4,
+		},
+		{
+			name:      "min rating stops scanning after max pages",
+			minRating: 5,
+			pageSize:  1,
+			scanPages: 2,
+			wantNext:  2,
+			wantLists: 2,
+		},
+		{
+			name:     "by rating",
+			sortBy:   SortByRating,
+			pageSize: 2,
+			wantRes:  []model.MovieDetails{rated(3, 5)},
+			wantNext: 2,
+			wantGets: []string{"b", "x"},
+		},
+		{
+			name:     "by rating next page",
+			sortBy:   SortByRating,
+			offset:   2,
+			pageSize: 2,
+			wantRes:  []model.MovieDetails{rated(4, 4), rated(1, 3)},
+			wantGets: []string{"d", "a"},
+		},
+		{
+			name:      "by rating min rating",
+			sortBy:    SortByRating,
+			minRating: 4,
+			wantRes:   []model.MovieDetails{rated(3, 5), rated(4, 4)},
+			wantGets:  []string{"b", "x", "d"},
+		},
+		{
+			name:      "degraded",
+			pageSize:  1,
+			ratingErr: errors.New("unavailable"),
+			wantRes:   []model.MovieDetails{{Metadata: list[0], Degraded: true}},
+			wantNext:  1,
+			wantLists: 1,
+		},
+		{
+			name:      "rating error by rating",
+			sortBy:    SortByRating,
+			ratingErr: errors.New("unavailable"),
+			wantErr:   errors.New("unavailable"),
+		},
+		{
+			name:      "rating error with min rating",
+			minRating: 4,
+			ratingErr: errors.New("unavailable"),
+			wantErr:   errors.New("unavailable"),
+			wantLists: 1,
+		},
+		{
+			name:    "invalid sort order",
+			sortBy:  "director",
+			wantErr: ErrInvalidSortOrder,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratingGW := &testRatingGateway{ratings: ratings, err: tt.ratingErr}
+			metadataGW := &testMetadataGateway{list: list}
+			c := New(ratingGW, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, configs.CacheConfig{}, zap.NewNop(), tally.NoopScope)
+			if tt.scanPages > 0 {
+				c.maxScanPages = tt.scanPages
+			}
+			res, next, err := c.ListMovies(context.Background(), tt.sortBy, tt.minRating, tt.offset, tt.pageSize)
+			assert.Equal(t, tt.wantRes, res, tt.name)
+			assert.Equal(t, tt.wantNext, next, tt.name)
+			assert.Equal(t, tt.wantErr, err, tt.name)
+			assert.ElementsMatch(t, tt.wantGets, metadataGW.gets, "only the metadata of listed movies is read")
+			assert.Equal(t, tt.wantLists, metadataGW.lists, tt.name)
+		})
+	}
+}
+
+func TestControllerGetCached(t *testing.T) {
+	ctx := context.Background()
+	ratingGW := &testRatingGateway{rating: 3}
+	metadataGW := &testMetadataGateway{metadata: &metadatamodel.Metadata{ID: "id", Title: "title"}}
+	cacheCfg := configs.CacheConfig{
+		Metadata: configs.CacheTTLConfig{TTL: time.Hour},
+		Rating:   configs.CacheTTLConfig{TTL: time.Hour},
+	}
+	c := New(ratingGW, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, cacheCfg, zap.NewNop(), tally.NoopScope)
+	_, err := c.Get(ctx, "id")
+	assert.NoError(t, err)
+
+	ratingGW.rating = 4
+	metadataGW.metadata = &metadatamodel.Metadata{ID: "id", Title: "new title"}
+	res, err := c.Get(ctx, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, "title", res.Metadata.Title)
+	assert.Equal(t, 3.0, *res.Rating)
+
+	_, err = c.RateMovie(ctx, "id", 5, "token")
+	assert.NoError(t, err)
+	res, err = c.Get(ctx, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, "title", res.Metadata.Title, "rating a movie keeps its metadata cached")
+	assert.Equal(t, 5.0, *res.Rating)
+}
+
+func TestControllerAttachAsset(t *testing.T) {
+	asset := &metadatamodel.Asset{Kind: metadatamodel.AssetKindPoster, Filename: "poster.png", Size: 3}
+	tests := []struct {
+		name       string
+		asset      *metadatamodel.Asset
+		gatewayErr error
+		wantAssets []metadatamodel.Asset
+		wantErr    error
+	}{
+		{
+			name:       "success",
+			asset:      asset,
+			wantAssets: []metadatamodel.Asset{*asset},
+		},
+		{
+			name:    "invalid kind",
+			asset:   &metadatamodel.Asset{Kind: "cover", Filename: "cover.png"},
+			wantErr: ErrInvalidAsset,
+		},
+		{
+			name:       "not found",
+			asset:      asset,
+			gatewayErr: errs.NotFound("not found"),
+			wantErr:    ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			metadataGW := &testMetadataGateway{metadata: &metadatamodel.Metadata{ID: "id", Title: "title"}}
+			cacheCfg := configs.CacheConfig{Metadata: configs.CacheTTLConfig{TTL: time.Hour}}
+			c := New(&testRatingGateway{rating: 3}, metadataGW, &testAuthGateway{}, configs.TimeoutsConfig{}, cacheCfg, zap.NewNop(), tally.NoopScope)
+			_, err := c.Get(ctx, "id")
+			assert.NoError(t, err)
+
+			metadataGW.err = tt.gatewayErr
+			err = c.AttachAsset(ctx, "id", tt.asset)
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+
+			metadataGW.err = nil
+			res, err := c.Get(ctx, "id")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAssets, res.Metadata.Assets, "attaching an asset invalidates cached metadata")
+		})
+	}
+}
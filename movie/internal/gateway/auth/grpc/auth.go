@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+	"mmoviecom/gen"
+	"mmoviecom/internal/grpcutil"
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
+
+	"go.uber.org/zap"
+)
+
+// Gateway defines a gRPC gateway for an auth service.
+type Gateway struct {
+	pool    *grpcutil.ConnPool
+	breaker *breaker.Breaker
+	retrier *retry.Retrier
+	logger  *zap.Logger
+}
+
+// New creates a new gRPC gateway for an auth service.
+func New(pool *grpcutil.ConnPool, breaker *breaker.Breaker, retrier *retry.Retrier, logger *zap.Logger) *Gateway {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "auth-gateway"),
+		zap.String(logging.FieldType, "grpc"),
+	)
+	return &Gateway{pool: pool, breaker: breaker, retrier: retrier, logger: logger}
+}
+
+// do calls fn through the circuit breaker, retrying failed attempts.
+func (g *Gateway) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return g.breaker.Do(ctx, func(ctx context.Context) error {
+		return g.retrier.Do(ctx, fn)
+	})
+}
+
+// ValidateToken validates a token and returns the name of its user.
+func (g *Gateway) ValidateToken(ctx context.Context, token string) (string, error) {
+	var res string
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = g.validateToken(ctx, token)
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) validateToken(ctx context.Context, token string) (string, error) {
+	conn, err := g.pool.Get("auth")
+	if err != nil {
+		return "", err
+	}
+	client := gen.NewAuthServiceClient(conn)
+	resp, err := client.ValidateToken(ctx, &gen.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return "", errs.FromGRPC(err)
+	}
+	return resp.GetUsername(), nil
+}
@@ -1,6 +0,0 @@
-package gateway
-
-import "errors"
-
-// ErrNotFound is returned when the data is not found.
-var ErrNotFound = errors.New("not found")
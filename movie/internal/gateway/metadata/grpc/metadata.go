@@ -5,74 +5,166 @@ import (
 	"mmoviecom/gen"
 	"mmoviecom/internal/grpcutil"
 	"mmoviecom/metadata/pkg/model"
-	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/hedge"
 	"mmoviecom/pkg/logging"
-	"time"
+	"mmoviecom/pkg/retry"
+	"strconv"
 
 	"go.uber.org/zap"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/status"
 )
 
 // Gateway defines a movie metadata gRPC gateway.
 type Gateway struct {
-	registry discovery.Registry
-	creds    credentials.TransportCredentials
-	logger   *zap.Logger
+	pool    *grpcutil.ConnPool
+	breaker *breaker.Breaker
+	retrier *retry.Retrier
+	hedger  *hedge.Hedger
+	logger  *zap.Logger
 }
 
 // New creates a new gRPC gateway for a movie metadata service.
-func New(registry discovery.Registry, creds credentials.TransportCredentials, logger *zap.Logger) *Gateway {
+func New(pool *grpcutil.ConnPool, breaker *breaker.Breaker, retrier *retry.Retrier, hedger *hedge.Hedger, logger *zap.Logger) *Gateway {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "metadata-gateway"),
 		zap.String(logging.FieldType, "grpc"),
 	)
-	return &Gateway{registry: registry, creds: creds, logger: logger}
+	return &Gateway{pool: pool, breaker: breaker, retrier: retrier, hedger: hedger, logger: logger}
+}
+
+// do calls fn through the circuit breaker, retrying failed attempts.
+func (g *Gateway) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return g.breaker.Do(ctx, func(ctx context.Context) error {
+		return g.retrier.Do(ctx, fn)
+	})
 }
 
 // Get returns movie metadata by a movie id.
 func (g *Gateway) Get(ctx context.Context, id string) (*model.Metadata, error) {
-	conn, err := grpcutil.ServiceConnection(ctx, "metadata", g.registry, g.creds)
+	var res *model.Metadata
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = hedge.Do(ctx, g.hedger, func(ctx context.Context) (*model.Metadata, error) {
+			return g.get(ctx, id)
+		})
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) get(ctx context.Context, id string) (*model.Metadata, error) {
+	conn, err := g.pool.Get("metadata")
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 	client := gen.NewMetadataServiceClient(conn)
-	const maxRetries = 5
-	for i := 0; i < maxRetries; i++ {
-		resp, err := client.GetMetadata(ctx, &gen.GetMetadataRequest{MovieId: id})
-		if err != nil {
-			if shouldRetry(err) {
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			return nil, err
-		}
-		return model.MetadataFromProto(resp.GetMetadata()), nil
+	resp, err := client.GetMetadata(ctx, &gen.GetMetadataRequest{MovieId: id})
+	if err != nil {
+		return nil, errs.FromGRPC(err)
 	}
-	return nil, err
+	return model.MetadataFromProto(resp.GetMetadata()), nil
 }
 
 // Put stores movie metadata by a movie id.
 func (g *Gateway) Put(ctx context.Context, metadata *model.Metadata) error {
-	conn, err := grpcutil.ServiceConnection(ctx, "metadata", g.registry, g.creds)
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.put(ctx, metadata)
+	})
+}
+
+func (g *Gateway) put(ctx context.Context, metadata *model.Metadata) error {
+	conn, err := g.pool.Get("metadata")
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 	client := gen.NewMetadataServiceClient(conn)
 	_, err = client.PutMetadata(ctx, &gen.PutMetadataRequest{Metadata: model.MetadataToProto(metadata)})
+	if err != nil {
+		return errs.FromGRPC(err)
+	}
+	return nil
+}
+
+// Create stores metadata of a new movie. It fails with an already
+// exists error if the movie exists. Creating is not idempotent, so failed
+// attempts are not retried: a create that succeeded on the server but timed
+// out on the client would be retried as an already exists error.
+func (g *Gateway) Create(ctx context.Context, metadata *model.Metadata) error {
+	return g.breaker.Do(ctx, func(ctx context.Context) error {
+		return g.create(ctx, metadata)
+	})
+}
+
+func (g *Gateway) create(ctx context.Context, metadata *model.Metadata) error {
+	conn, err := g.pool.Get("metadata")
 	if err != nil {
 		return err
 	}
+	client := gen.NewMetadataServiceClient(conn)
+	_, err = client.CreateMetadata(ctx, &gen.CreateMetadataRequest{Metadata: model.MetadataToProto(metadata)})
+	if err != nil {
+		return errs.FromGRPC(err)
+	}
 	return nil
 }
 
-func shouldRetry(err error) bool {
-	e, ok := status.FromError(err)
-	if !ok {
-		return false
+// PutAsset links an asset to a movie by a movie id.
+func (g *Gateway) PutAsset(ctx context.Context, id string, asset *model.Asset) error {
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.putAsset(ctx, id, asset)
+	})
+}
+
+func (g *Gateway) putAsset(ctx context.Context, id string, asset *model.Asset) error {
+	conn, err := g.pool.Get("metadata")
+	if err != nil {
+		return err
+	}
+	client := gen.NewMetadataServiceClient(conn)
+	_, err = client.PutAsset(ctx, &gen.PutAssetRequest{MovieId: id, Asset: model.AssetToProto(asset)})
+	if err != nil {
+		return errs.FromGRPC(err)
+	}
+	return nil
+}
+
+// List returns a page of movie metadata ordered by title and movie id, and the offset
+// of the next page or 0 if there are no more movies.
+func (g *Gateway) List(ctx context.Context, offset int, pageSize int) ([]model.Metadata, int, error) {
+	var res []model.Metadata
+	var next int
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, next, err = g.list(ctx, offset, pageSize)
+		return err
+	})
+	return res, next, err
+}
+
+func (g *Gateway) list(ctx context.Context, offset int, pageSize int) ([]model.Metadata, int, error) {
+	conn, err := g.pool.Get("metadata")
+	if err != nil {
+		return nil, 0, err
+	}
+	client := gen.NewMetadataServiceClient(conn)
+	req := &gen.ListMetadataRequest{PageSize: int32(pageSize)}
+	if offset > 0 {
+		req.PageToken = strconv.Itoa(offset)
+	}
+	resp, err := client.ListMetadata(ctx, req)
+	if err != nil {
+		return nil, 0, errs.FromGRPC(err)
+	}
+	res := make([]model.Metadata, 0, len(resp.Metadata))
+	for _, m := range resp.Metadata {
+		res = append(res, *model.MetadataFromProto(m))
+	}
+	var next int
+	if resp.NextPageToken != "" {
+		if next, err = strconv.Atoi(resp.NextPageToken); err != nil {
+			return nil, 0, err
+		}
 	}
-	return e.Code() == codes.DeadlineExceeded || e.Code() == codes.ResourceExhausted || e.Code() == codes.Unavailable
+	return res, next, nil
 }
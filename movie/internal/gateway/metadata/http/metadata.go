@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"mmoviecom/metadata/pkg/model"
-	"mmoviecom/movie/internal/gateway"
 	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/lb"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -17,25 +18,42 @@ import (
 // Gateway defines a movie metadata HTTP gateway.
 type Gateway struct {
 	registry discovery.Registry
+	balancer *lb.Balancer
+	retrier  *retry.Retrier
 	logger   *zap.Logger
 }
 
 // New creates a new HTTP gateway for a movie metadata service.
-func New(registry discovery.Registry, logger *zap.Logger) *Gateway {
+func New(registry discovery.Registry, balancer *lb.Balancer, retrier *retry.Retrier, logger *zap.Logger) *Gateway {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "metadata-gateway"),
 		zap.String(logging.FieldType, "http"),
 	)
-	return &Gateway{registry: registry, logger: logger}
+	return &Gateway{registry: registry, balancer: balancer, retrier: retrier, logger: logger}
 }
 
 // Get gets movie metadata by a movie id.
 func (g *Gateway) Get(ctx context.Context, id string) (*model.Metadata, error) {
+	var res *model.Metadata
+	err := g.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = g.get(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) get(ctx context.Context, id string) (*model.Metadata, error) {
 	addrs, err := g.registry.ServiceAddresses(ctx, "metadata")
 	if err != nil {
 		return nil, err
 	}
-	url := "http://" + addrs[rand.Intn(len(addrs))] + "/metadata/"
+	addr, done, err := g.balancer.Pick(addrs)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	url := "http://" + addr + "/metadata/"
 	g.logger.Debug("Calling metadata service",
 		zap.String("url", url),
 		zap.String("method", "GET"),
@@ -54,10 +72,8 @@ func (g *Gateway) Get(ctx context.Context, id string) (*model.Metadata, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, gateway.ErrNotFound
-	} else if resp.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("non-2xx status code: %v", resp)
+	if resp.StatusCode/100 != 2 {
+		return nil, errs.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("non-2xx status code: %v", resp))
 	}
 	var v *model.Metadata
 	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
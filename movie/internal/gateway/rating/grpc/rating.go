@@ -4,56 +4,158 @@ import (
 	"context"
 	"mmoviecom/gen"
 	"mmoviecom/internal/grpcutil"
-	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/hedge"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 	"mmoviecom/rating/pkg/model"
+	"strconv"
 
 	"go.uber.org/zap"
-	"google.golang.org/grpc/credentials"
 )
 
 // Gateway defines an gRPC getaway for a rating service.
 type Gateway struct {
-	registry discovery.Registry
-	creds    credentials.TransportCredentials
-	logger   *zap.Logger
+	pool    *grpcutil.ConnPool
+	breaker *breaker.Breaker
+	retrier *retry.Retrier
+	hedger  *hedge.Hedger
+	logger  *zap.Logger
 }
 
 // New creates a new gPRC gateway for a rating service.
-func New(registry discovery.Registry, creds credentials.TransportCredentials, logger *zap.Logger) *Gateway {
+func New(pool *grpcutil.ConnPool, breaker *breaker.Breaker, retrier *retry.Retrier, hedger *hedge.Hedger, logger *zap.Logger) *Gateway {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "rating-gateway"),
 		zap.String(logging.FieldType, "grpc"),
 	)
-	return &Gateway{registry: registry, creds: creds, logger: logger}
+	return &Gateway{pool: pool, breaker: breaker, retrier: retrier, hedger: hedger, logger: logger}
+}
+
+// do calls fn through the circuit breaker, retrying failed attempts.
+func (g *Gateway) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return g.breaker.Do(ctx, func(ctx context.Context) error {
+		return g.retrier.Do(ctx, fn)
+	})
 }
 
 // GetAggregatedRating returns the aggregated rating for a
 // record or ErrNotFound if there are no rating for it.
 func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.RecordId, recordType model.RecordType) (float64, error) {
-	conn, err := grpcutil.ServiceConnection(ctx, "rating", g.registry, g.creds)
+	var res float64
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = hedge.Do(ctx, g.hedger, func(ctx context.Context) (float64, error) {
+			return g.getAggregatedRating(ctx, recordID, recordType)
+		})
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) getAggregatedRating(ctx context.Context, recordID model.RecordId, recordType model.RecordType) (float64, error) {
+	conn, err := g.pool.Get("rating")
 	if err != nil {
 		return 0, err
 	}
-	defer conn.Close()
 	client := gen.NewRatingServiceClient(conn)
 	resp, err := client.GetAggregatedRating(ctx, &gen.GetAggregatedRatingRequest{RecordId: string(recordID), RecordType: string(recordType)})
 	if err != nil {
-		return 0, err
+		return 0, errs.FromGRPC(err)
 	}
 	return resp.RatingValue, nil
 }
 
+// GetAggregatedRatings returns the aggregated ratings of multiple records
+// of a given type. Records without ratings are omitted.
+func (g *Gateway) GetAggregatedRatings(ctx context.Context, recordIds []model.RecordId, recordType model.RecordType) (map[model.RecordId]float64, error) {
+	var res map[model.RecordId]float64
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = g.getAggregatedRatings(ctx, recordIds, recordType)
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) getAggregatedRatings(ctx context.Context, recordIds []model.RecordId, recordType model.RecordType) (map[model.RecordId]float64, error) {
+	conn, err := g.pool.Get("rating")
+	if err != nil {
+		return nil, err
+	}
+	client := gen.NewRatingServiceClient(conn)
+	req := &gen.GetAggregatedRatingsRequest{RecordType: string(recordType)}
+	for _, id := range recordIds {
+		req.RecordIds = append(req.RecordIds, string(id))
+	}
+	resp, err := client.GetAggregatedRatings(ctx, req)
+	if err != nil {
+		return nil, errs.FromGRPC(err)
+	}
+	res := make(map[model.RecordId]float64, len(resp.Records))
+	for _, r := range resp.Records {
+		res[model.RecordId(r.RecordId)] = r.RatingValue
+	}
+	return res, nil
+}
+
+// GetTopRated returns a page of records of a given type with at least
+// minVotes ratings, ordered by aggregated rating, and the offset of
+// the next page or 0 if there are no more records.
+func (g *Gateway) GetTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, pageSize int) ([]model.RecordAggregate, int, error) {
+	var res []model.RecordAggregate
+	var next int
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, next, err = g.getTopRated(ctx, recordType, minVotes, offset, pageSize)
+		return err
+	})
+	return res, next, err
+}
+
+func (g *Gateway) getTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, pageSize int) ([]model.RecordAggregate, int, error) {
+	conn, err := g.pool.Get("rating")
+	if err != nil {
+		return nil, 0, err
+	}
+	client := gen.NewRatingServiceClient(conn)
+	req := &gen.GetTopRatedRequest{RecordType: string(recordType), MinVotes: int32(minVotes), PageSize: int32(pageSize)}
+	if offset > 0 {
+		req.PageToken = strconv.Itoa(offset)
+	}
+	resp, err := client.GetTopRated(ctx, req)
+	if err != nil {
+		return nil, 0, errs.FromGRPC(err)
+	}
+	res := make([]model.RecordAggregate, 0, len(resp.Records))
+	for _, r := range resp.Records {
+		res = append(res, model.RecordAggregate{RecordId: model.RecordId(r.RecordId), Rating: r.RatingValue, Count: int(r.Count)})
+	}
+	var next int
+	if resp.NextPageToken != "" {
+		if next, err = strconv.Atoi(resp.NextPageToken); err != nil {
+			return nil, 0, err
+		}
+	}
+	return res, next, nil
+}
+
 func (g *Gateway) PutRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating, token string) error {
-	conn, err := grpcutil.ServiceConnection(ctx, "rating", g.registry, g.creds)
+	return g.do(ctx, func(ctx context.Context) error {
+		return g.putRating(ctx, recordId, recordType, rating, token)
+	})
+}
+
+func (g *Gateway) putRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating, token string) error {
+	conn, err := g.pool.Get("rating")
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 	client := gen.NewRatingServiceClient(conn)
 	_, err = client.PutRating(ctx, &gen.PutRatingRequest{RecordId: string(recordId), RecordType: string(recordType), UserId: string(rating.UserId), RatingValue: int32(rating.Value), Token: token})
 	if err != nil {
-		return err
+		return errs.FromGRPC(err)
 	}
 	return nil
 }
@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
-	"mmoviecom/movie/internal/gateway"
 	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/lb"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 	"mmoviecom/rating/pkg/model"
 	"net/http"
 
@@ -17,27 +18,44 @@ import (
 // Gateway defines an HTTP gateway for a rating service.
 type Gateway struct {
 	registry discovery.Registry
+	balancer *lb.Balancer
+	retrier  *retry.Retrier
 	logger   *zap.Logger
 }
 
 // New creates a new HTTP gateway for a rating service.
-func New(registry discovery.Registry, logger *zap.Logger) *Gateway {
+func New(registry discovery.Registry, balancer *lb.Balancer, retrier *retry.Retrier, logger *zap.Logger) *Gateway {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "rating-gateway"),
 		zap.String(logging.FieldType, "http"),
 	)
 
-	return &Gateway{registry: registry, logger: logger}
+	return &Gateway{registry: registry, balancer: balancer, retrier: retrier, logger: logger}
 }
 
 // GetAggregatedRating return the aggregated rating for a
 // record or ErrNotFound if there are no ratings for it.
 func (g *Gateway) GetAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType) (float64, error) {
+	var res float64
+	err := g.retrier.Do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = g.getAggregatedRating(ctx, recordId, recordType)
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) getAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType) (float64, error) {
 	addrs, err := g.registry.ServiceAddresses(ctx, "rating")
 	if err != nil {
 		return 0, err
 	}
-	url := "http://" + addrs[rand.Intn(len(addrs))] + "/rating/"
+	addr, done, err := g.balancer.Pick(addrs)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	url := "http://" + addr + "/rating/"
 	g.logger.Debug("Calling rating service",
 		zap.String("url", url),
 		zap.String("method", "GET"),
@@ -57,10 +75,8 @@ func (g *Gateway) GetAggregatedRating(ctx context.Context, recordId model.Record
 		return 0, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return 0, gateway.ErrNotFound
-	} else if resp.StatusCode/100 != 2 {
-		return 0, fmt.Errorf("non-2xx response: %v", resp)
+	if resp.StatusCode/100 != 2 {
+		return 0, errs.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("non-2xx response: %v", resp))
 	}
 	var v float64
 	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
@@ -71,11 +87,22 @@ func (g *Gateway) GetAggregatedRating(ctx context.Context, recordId model.Record
 
 // PutRating writes a rating.
 func (g *Gateway) PutRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating) error {
+	return g.retrier.Do(ctx, func(ctx context.Context) error {
+		return g.putRating(ctx, recordId, recordType, rating)
+	})
+}
+
+func (g *Gateway) putRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating) error {
 	addrs, err := g.registry.ServiceAddresses(ctx, "rating")
 	if err != nil {
 		return err
 	}
-	url := "http://" + addrs[rand.Intn(len(addrs))] + "/rating/"
+	addr, done, err := g.balancer.Pick(addrs)
+	if err != nil {
+		return err
+	}
+	defer done()
+	url := "http://" + addr + "/rating/"
 	g.logger.Debug("Calling rating service.",
 		zap.String("url", url),
 		zap.String("method", "PUT"),
@@ -97,10 +124,8 @@ func (g *Gateway) PutRating(ctx context.Context, recordId model.RecordId, record
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return gateway.ErrNotFound
-	} else if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("non-2xx response: %v", resp)
+	if resp.StatusCode/100 != 2 {
+		return errs.FromHTTPStatus(resp.StatusCode, fmt.Sprintf("non-2xx response: %v", resp))
 	}
 	return nil
 }
@@ -2,40 +2,93 @@ package grpc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"mmoviecom/gen"
-	"mmoviecom/metadata/pkg/model"
+	metadatamodel "mmoviecom/metadata/pkg/model"
 	"mmoviecom/movie/internal/controller/movie"
+	"mmoviecom/movie/internal/storage"
+	"mmoviecom/movie/internal/upload"
+	"mmoviecom/movie/pkg/model"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
-	"os"
+	ratingmodel "mmoviecom/rating/pkg/model"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// checksumTrailer defines the trailer of DownloadFile
+// with the SHA-256 checksum of the streamed bytes.
+const checksumTrailer = "sha256"
+
+// downloadChunkSize defines the size of streamed file chunks.
+const downloadChunkSize = 64 * 1024
+
+// errInvalidRange is returned when a download starts beyond the end of a file.
+var errInvalidRange = errs.InvalidArgument("offset exceeds the file size")
+
+// errNoMovieID is returned when an upload has an asset kind but no movie id.
+var errNoMovieID = errs.InvalidArgument("asset kind requires a movie id")
+
+// errPosterNotUploaded is returned when a movie poster has not been uploaded.
+var errPosterNotUploaded = errs.InvalidArgument("poster is not uploaded")
+
+type fileStorage interface {
+	Put(ctx context.Context, name string, r io.Reader, overwrite bool) (*storage.Blob, error)
+	Stat(ctx context.Context, name string) (*storage.Blob, error)
+	Open(ctx context.Context, name string) (io.ReadSeekCloser, error)
+}
+
 // Handler defines movie GRPC handler.
 type Handler struct {
 	gen.UnimplementedMovieServiceServer
 	ctrl                   *movie.Controller
+	storage                fileStorage
+	uploads                *upload.Manager
 	logger                 *zap.Logger
 	getMovieDetailsMetrics *metrics.EndpointMetrics
+	rateMovieMetrics       *metrics.EndpointMetrics
+	createMovieMetrics     *metrics.EndpointMetrics
+	updateMovieMetrics     *metrics.EndpointMetrics
+	listMoviesMetrics      *metrics.EndpointMetrics
+	uploadFileMetrics      *metrics.EndpointMetrics
+	initUploadMetrics      *metrics.EndpointMetrics
+	uploadStatusMetrics    *metrics.EndpointMetrics
+	downloadFileMetrics    *metrics.EndpointMetrics
 }
 
-// New creates a new movie gRPC handler.
-func New(ctrl *movie.Controller, logger *zap.Logger, scope tally.Scope) *Handler {
+// New creates a new movie gRPC handler. Uploaded files are stored in the
+// file storage, resumable uploads are managed by the upload manager.
+func New(ctrl *movie.Controller, storage fileStorage, uploads *upload.Manager, logger *zap.Logger, scope tally.Scope) *Handler {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "handler"),
 		zap.String(logging.FieldType, "grpc"),
 	)
 	return &Handler{
 		ctrl:                   ctrl,
+		storage:                storage,
+		uploads:                uploads,
 		logger:                 logger,
 		getMovieDetailsMetrics: metrics.NewEndpointMetrics(scope, "GetMovieDetails"),
+		rateMovieMetrics:       metrics.NewEndpointMetrics(scope, "RateMovie"),
+		createMovieMetrics:     metrics.NewEndpointMetrics(scope, "CreateMovie"),
+		updateMovieMetrics:     metrics.NewEndpointMetrics(scope, "UpdateMovie"),
+		listMoviesMetrics:      metrics.NewEndpointMetrics(scope, "ListMovies"),
+		uploadFileMetrics:      metrics.NewEndpointMetrics(scope, "UploadFile"),
+		initUploadMetrics:      metrics.NewEndpointMetrics(scope, "InitUpload"),
+		uploadStatusMetrics:    metrics.NewEndpointMetrics(scope, "QueryUploadStatus"),
+		downloadFileMetrics:    metrics.NewEndpointMetrics(scope, "DownloadFile"),
 	}
 }
 
@@ -47,56 +100,485 @@ func (h *Handler) GetMovieDetails(ctx context.Context, req *gen.GetMovieDetailsR
 		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty id")
 	}
 	m, err := h.ctrl.Get(ctx, req.MovieId)
-	if err != nil && errors.Is(err, movie.ErrNotFound) {
-		h.getMovieDetailsMetrics.NotFoundErrors.Inc(1)
-
-		return nil, status.Errorf(codes.NotFound, "not found")
-	} else if err != nil {
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
 		h.getMovieDetailsMetrics.InternalErrors.Inc(1)
 		h.logger.Error("Cannot get movie details", zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "internal server error")
-	}
-	var rating float64
-	if m.Rating != nil {
-		rating = *m.Rating
+	} else if err != nil {
+		h.getMovieDetailsMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	h.getMovieDetailsMetrics.Successes.Inc(1)
-	return &gen.GetMovieDetailsResponse{
-		MovieDetails: &gen.MovieDetails{
-			Metadata: model.MetadataToProto(&m.Metadata),
-			Rating:   rating,
-		},
-	}, nil
+	return &gen.GetMovieDetailsResponse{MovieDetails: model.MovieDetailsToProto(m)}, nil
 }
 
-// UploadFile handles streaming file upload.
-func (h *Handler) UploadFile(stream gen.MovieService_UploadFileServer) error {
-	var filename string
-	var file *os.File
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			return stream.SendAndClose(&gen.UploadResponse{
-				Message: fmt.Sprintf("File %s uploaded successfully", filename),
-			})
+// RateMovie writes a rating of a movie by the caller and returns the updated aggregated rating.
+func (h *Handler) RateMovie(ctx context.Context, req *gen.RateMovieRequest) (*gen.RateMovieResponse, error) {
+	h.rateMovieMetrics.Calls.Inc(1)
+	if req == nil || req.MovieId == "" {
+		h.rateMovieMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty id")
+	}
+	rating, err := h.ctrl.RateMovie(ctx, req.MovieId, ratingmodel.RatingValue(req.RatingValue), req.Token)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.rateMovieMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot rate movie", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.rateMovieMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.rateMovieMetrics.Successes.Inc(1)
+	return &gen.RateMovieResponse{Rating: rating}, nil
+}
+
+// CreateMovie creates a new movie and returns its details.
+func (h *Handler) CreateMovie(ctx context.Context, req *gen.CreateMovieRequest) (*gen.CreateMovieResponse, error) {
+	h.createMovieMetrics.Calls.Inc(1)
+	if req == nil || req.Metadata == nil {
+		h.createMovieMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or metadata")
+	}
+	err := h.checkPoster(ctx, req.Token, req.Poster)
+	var m *model.MovieDetails
+	if err == nil {
+		m, err = h.ctrl.CreateMovie(ctx, metadatamodel.MetadataFromProto(req.Metadata), req.Poster, req.Token)
+	}
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.createMovieMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot create movie", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.createMovieMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.createMovieMetrics.Successes.Inc(1)
+	return &gen.CreateMovieResponse{MovieDetails: model.MovieDetailsToProto(m)}, nil
+}
+
+// UpdateMovie updates an existing movie and returns its details.
+func (h *Handler) UpdateMovie(ctx context.Context, req *gen.UpdateMovieRequest) (*gen.UpdateMovieResponse, error) {
+	h.updateMovieMetrics.Calls.Inc(1)
+	if req == nil || req.Metadata == nil {
+		h.updateMovieMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or metadata")
+	}
+	err := h.checkPoster(ctx, req.Token, req.Poster)
+	var m *model.MovieDetails
+	if err == nil {
+		m, err = h.ctrl.UpdateMovie(ctx, metadatamodel.MetadataFromProto(req.Metadata), req.Poster, req.Token)
+	}
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.updateMovieMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot update movie", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.updateMovieMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.updateMovieMetrics.Successes.Inc(1)
+	return &gen.UpdateMovieResponse{MovieDetails: model.MovieDetailsToProto(m)}, nil
+}
+
+// ListMovies returns a page of movie details sorted by title or by rating.
+func (h *Handler) ListMovies(ctx context.Context, req *gen.ListMoviesRequest) (*gen.ListMoviesResponse, error) {
+	h.listMoviesMetrics.Calls.Inc(1)
+	if req == nil {
+		h.listMoviesMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req")
+	}
+	var offset int
+	if req.PageToken != "" {
+		v, err := strconv.Atoi(req.PageToken)
+		if err != nil || v < 0 {
+			h.listMoviesMetrics.InvalidArgumentErrors.Inc(1)
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
 		}
-		if err != nil {
-			return err
+		offset = v
+	}
+	movies, next, err := h.ctrl.ListMovies(ctx, req.SortBy, req.MinRating, offset, int(req.PageSize))
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.listMoviesMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot list movies", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.listMoviesMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.ListMoviesResponse{}
+	for i := range movies {
+		resp.Movies = append(resp.Movies, model.MovieDetailsToProto(&movies[i]))
+	}
+	if next > 0 {
+		resp.NextPageToken = strconv.Itoa(next)
+	}
+	h.listMoviesMetrics.Successes.Inc(1)
+	return resp, nil
+}
+
+// checkPoster checks that a poster, if any, has been uploaded. The token is
+// validated first, so callers without a valid token cannot probe which files exist.
+func (h *Handler) checkPoster(ctx context.Context, token string, poster string) error {
+	if poster == "" {
+		return nil
+	}
+	if err := h.ctrl.ValidateToken(ctx, token); err != nil {
+		return err
+	}
+	if !h.uploaded(ctx, poster) {
+		return fmt.Errorf("%w: %s", errPosterNotUploaded, poster)
+	}
+	return nil
+}
+
+// uploaded reports whether a file has been uploaded with UploadFile.
+func (h *Handler) uploaded(ctx context.Context, filename string) bool {
+	_, err := h.storage.Stat(ctx, filename)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.logger.Warn("Cannot check uploaded file", zap.String("filename", filename), zap.Error(err))
+	}
+	return err == nil
+}
+
+// UploadFile handles streaming file upload. The token and the file name are
+// taken from the first request and the file is stored once the stream is closed.
+// Requests with an upload id continue a resumable upload instead. If the
+// first request has a movie id, the file is stored under a path scoped by
+// the movie and the asset kind and linked to the movie as an asset of that
+// kind. A stored file is replaced only if the first request asks to overwrite it.
+func (h *Handler) UploadFile(stream gen.MovieService_UploadFileServer) error {
+	h.uploadFileMetrics.Calls.Inc(1)
+	req, err := stream.Recv()
+	if err == io.EOF {
+		h.uploadFileMetrics.InvalidArgumentErrors.Inc(1)
+		return status.Error(codes.InvalidArgument, "empty upload")
+	} else if err != nil {
+		return err
+	}
+	resp, err := h.uploadFile(stream, req)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.uploadFileMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot upload file",
+			zap.String("filename", req.GetFilename()),
+			zap.String("uploadId", req.GetUploadId()),
+			zap.Error(err),
+		)
+		return status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.uploadFileMetrics.IncError(err)
+		return errs.ToGRPC(err)
+	}
+	h.uploadFileMetrics.Successes.Inc(1)
+	return stream.SendAndClose(resp)
+}
+
+// uploadFile checks the token of an upload stream and continues
+// a resumable upload or stores the file.
+func (h *Handler) uploadFile(stream gen.MovieService_UploadFileServer, req *gen.UploadRequest) (*gen.UploadResponse, error) {
+	if err := h.ctrl.ValidateToken(stream.Context(), req.GetToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUploadId() != "" {
+		return h.resumeUpload(stream, req)
+	}
+	return h.upload(stream, req)
+}
+
+// upload stores the file of an upload stream and links it to the movie
+// targeted by the first request.
+func (h *Handler) upload(stream gen.MovieService_UploadFileServer, req *gen.UploadRequest) (*gen.UploadResponse, error) {
+	ctx := stream.Context()
+	target, err := h.uploadTarget(ctx, req.GetMovieId(), req.GetAssetKind())
+	if err != nil {
+		return nil, err
+	}
+	name, err := h.storageName(ctx, target, req.GetFilename(), "", req.GetOverwrite())
+	if err != nil {
+		return nil, err
+	}
+	blob, err := h.storage.Put(ctx, name, &uploadReader{stream: stream, buf: req.GetChunk()}, req.GetOverwrite())
+	if err != nil {
+		return nil, err
+	}
+	asset, err := h.attachAsset(ctx, target, blob)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gen.UploadResponse{
+		Message:     fmt.Sprintf("File %s uploaded successfully", blob.Name),
+		Filename:    blob.Name,
+		Size:        blob.Size,
+		ContentType: blob.ContentType,
+		Sha256:      blob.SHA256,
+	}
+	setAsset(resp, target, asset)
+	return resp, nil
+}
+
+// resumeUpload writes the chunks of an upload stream to a resumable upload.
+// Once the upload is completed, the file is linked to the movie targeted
+// by InitUpload. An upload whose file cannot be linked is discarded, so
+// the client starts it again instead of finding it completed.
+func (h *Handler) resumeUpload(stream gen.MovieService_UploadFileServer, req *gen.UploadRequest) (*gen.UploadResponse, error) {
+	ctx := stream.Context()
+	r := &uploadReader{stream: stream, buf: req.GetChunk(), checkOffsets: true, offset: req.GetOffset() + int64(len(req.GetChunk()))}
+	s, err := h.uploads.Write(ctx, req.GetUploadId(), req.GetOffset(), r)
+	if err != nil {
+		return nil, err
+	}
+	resp := &gen.UploadResponse{
+		Message:  fmt.Sprintf("Received %d of %d bytes of file %s", s.Received, s.Size, s.Filename),
+		Filename: s.Filename,
+		UploadId: s.ID,
+		Received: s.Received,
+	}
+	if s.Blob == nil {
+		return resp, nil
+	}
+	asset, err := h.attachAsset(ctx, s.Target, s.Blob)
+	if err != nil {
+		// The stored file is linked again when the upload is retried.
+		h.uploads.Discard(ctx, s.ID)
+		return nil, err
+	}
+	resp.Message = fmt.Sprintf("File %s uploaded successfully", s.Filename)
+	resp.Size = s.Blob.Size
+	resp.ContentType = s.Blob.ContentType
+	resp.Sha256 = s.Blob.SHA256
+	resp.Completed = true
+	setAsset(resp, s.Target, asset)
+	return resp, nil
+}
+
+// uploadTarget returns the movie asset an upload is linked to. The movie
+// must exist and the asset kind must be supported. Uploads without a movie
+// id are not linked to a movie.
+func (h *Handler) uploadTarget(ctx context.Context, movieID string, kind string) (upload.Target, error) {
+	if movieID == "" && kind != "" {
+		return upload.Target{}, errNoMovieID
+	} else if movieID == "" {
+		return upload.Target{}, nil
+	}
+	target := upload.Target{MovieID: movieID, Kind: metadatamodel.AssetKind(kind)}
+	if err := h.ctrl.ValidateAsset(ctx, target.MovieID, target.Kind); err != nil {
+		return upload.Target{}, err
+	}
+	return target, nil
+}
+
+// storageName returns the name a file of an upload is stored under. Files
+// linked to a movie are stored under a path scoped by the movie and the asset
+// kind. Unless overwrite is true, an upload with a known checksum of a file
+// stored with different content is rejected before its data is received.
+// Uploads of the stored content are accepted, so an upload whose file was
+// stored but not linked to its movie can be retried.
+func (h *Handler) storageName(ctx context.Context, target upload.Target, filename string, sha256 string, overwrite bool) (string, error) {
+	name := filename
+	if target.MovieID != "" {
+		var err error
+		if name, err = storage.AssetPath(target.MovieID, string(target.Kind), filename); err != nil {
+			return "", err
 		}
-		if file == nil {
-			filename = req.GetFilename()
-			file, err = os.Create(filename)
-			if err != nil {
+	} else if err := storage.ValidateName(filename); err != nil {
+		return "", err
+	}
+	if overwrite || sha256 == "" {
+		return name, nil
+	}
+	blob, err := h.storage.Stat(ctx, name)
+	if err == nil && !strings.EqualFold(blob.SHA256, sha256) {
+		return "", storage.ErrAlreadyExists
+	} else if err != nil && !errors.Is(err, errs.ErrNotFound) {
+		return "", err
+	}
+	return name, nil
+}
+
+// attachAsset links a stored file to the movie of the upload target and
+// returns the asset record, or nil if the target has no movie. The asset
+// is named by the file name and downloaded by its path, the blob name.
+func (h *Handler) attachAsset(ctx context.Context, target upload.Target, blob *storage.Blob) (*metadatamodel.Asset, error) {
+	if target.MovieID == "" {
+		return nil, nil
+	}
+	asset := &metadatamodel.Asset{
+		Kind:        target.Kind,
+		Filename:    path.Base(blob.Name),
+		Path:        blob.Name,
+		Size:        blob.Size,
+		ContentType: blob.ContentType,
+		SHA256:      blob.SHA256,
+	}
+	if err := h.ctrl.AttachAsset(ctx, target.MovieID, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// setAsset adds the asset linked to a movie to an upload response.
+func setAsset(resp *gen.UploadResponse, target upload.Target, asset *metadatamodel.Asset) {
+	if asset == nil {
+		return
+	}
+	resp.Message = fmt.Sprintf("File %s uploaded successfully as %s of movie %s", asset.Filename, asset.Kind, target.MovieID)
+	resp.MovieId = target.MovieID
+	resp.Asset = metadatamodel.AssetToProto(asset)
+}
+
+// InitUpload starts a resumable upload of a file of a given size and checksum
+// on behalf of the user of the token.
+// If the request has a movie id, the file is linked to the movie as an asset
+// of the requested kind once the upload is completed. A stored file is
+// replaced only if the request asks to overwrite it.
+func (h *Handler) InitUpload(ctx context.Context, req *gen.InitUploadRequest) (*gen.InitUploadResponse, error) {
+	h.initUploadMetrics.Calls.Inc(1)
+	if req == nil {
+		h.initUploadMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req")
+	}
+	s, err := h.initUpload(ctx, req)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.initUploadMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot init upload", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.initUploadMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.initUploadMetrics.Successes.Inc(1)
+	return &gen.InitUploadResponse{UploadId: s.ID}, nil
+}
+
+func (h *Handler) initUpload(ctx context.Context, req *gen.InitUploadRequest) (*upload.Session, error) {
+	if err := h.ctrl.ValidateToken(ctx, req.Token); err != nil {
+		return nil, err
+	}
+	target, err := h.uploadTarget(ctx, req.MovieId, req.AssetKind)
+	if err != nil {
+		return nil, err
+	}
+	name, err := h.storageName(ctx, target, req.Filename, req.Sha256, req.Overwrite)
+	if err != nil {
+		return nil, err
+	}
+	return h.uploads.Init(ctx, name, req.Size, req.Sha256, target, req.Overwrite)
+}
+
+// QueryUploadStatus returns the number of received bytes of a resumable upload.
+func (h *Handler) QueryUploadStatus(ctx context.Context, req *gen.QueryUploadStatusRequest) (*gen.QueryUploadStatusResponse, error) {
+	h.uploadStatusMetrics.Calls.Inc(1)
+	if req == nil || req.UploadId == "" {
+		h.uploadStatusMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty upload id")
+	}
+	s, err := h.uploads.Status(ctx, req.UploadId)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.uploadStatusMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot get upload status", zap.Error(err))
+		return nil, status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.uploadStatusMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.uploadStatusMetrics.Successes.Inc(1)
+	return &gen.QueryUploadStatusResponse{
+		UploadId:  s.ID,
+		Filename:  s.Filename,
+		Size:      s.Size,
+		Received:  s.Received,
+		Completed: s.Blob != nil,
+	}, nil
+}
+
+// DownloadFile streams length bytes of a file from the offset or, if length
+// is zero, the rest of the file, to the user of the token. The SHA-256 checksum of the streamed bytes
+// is sent in the sha256 trailer.
+func (h *Handler) DownloadFile(req *gen.DownloadRequest, stream gen.MovieService_DownloadFileServer) error {
+	h.downloadFileMetrics.Calls.Inc(1)
+	if req == nil || req.Offset < 0 || req.Length < 0 {
+		h.downloadFileMetrics.InvalidArgumentErrors.Inc(1)
+		return status.Errorf(codes.InvalidArgument, "nil req or invalid range")
+	}
+	err := h.download(req, stream)
+	if err != nil && errs.KindOf(err) == errs.KindInternal {
+		h.downloadFileMetrics.InternalErrors.Inc(1)
+		h.logger.Error("Cannot download file", zap.String("filename", req.Filename), zap.Error(err))
+		return status.Errorf(codes.Internal, "internal server error")
+	} else if err != nil {
+		h.downloadFileMetrics.IncError(err)
+		return errs.ToGRPC(err)
+	}
+	h.downloadFileMetrics.Successes.Inc(1)
+	return nil
+}
+
+func (h *Handler) download(req *gen.DownloadRequest, stream gen.MovieService_DownloadFileServer) error {
+	if err := h.ctrl.ValidateToken(stream.Context(), req.Token); err != nil {
+		return err
+	}
+	f, err := h.storage.Open(stream.Context(), req.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if req.Offset > size {
+		return errInvalidRange
+	}
+	if _, err := f.Seek(req.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if req.Length > 0 {
+		r = io.LimitReader(f, req.Length)
+	}
+	checksum := sha256.New()
+	offset := req.Offset
+	buf := make([]byte, downloadChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			checksum.Write(buf[:n])
+			if err := stream.Send(&gen.DownloadResponse{Chunk: buf[:n], Offset: offset, Size: size}); err != nil {
 				return err
 			}
-			defer func() {
-				if err := file.Close(); err != nil {
-					h.logger.Error("Cannot close file", zap.Error(err))
-				}
-			}()
+			offset += int64(n)
 		}
-		if _, err := file.Write(req.Chunk); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
 			return err
 		}
 	}
+	stream.SetTrailer(metadata.Pairs(checksumTrailer, hex.EncodeToString(checksum.Sum(nil))))
+	return nil
+}
+
+// uploadReader reads the chunks of an upload stream. Chunk offsets of
+// resumable uploads are checked to follow the previous chunks.
+type uploadReader struct {
+	stream       gen.MovieService_UploadFileServer
+	buf          []byte
+	checkOffsets bool
+	offset       int64
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if r.checkOffsets && req.GetOffset() != r.offset {
+			return 0, storage.ErrInvalidOffset
+		}
+		r.buf = req.GetChunk()
+		r.offset += int64(len(r.buf))
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
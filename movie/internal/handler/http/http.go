@@ -2,9 +2,8 @@ package http
 
 import (
 	"encoding/json"
-	"errors"
 	"mmoviecom/movie/internal/controller/movie"
-	"mmoviecom/movie/internal/gateway"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"net/http"
 
@@ -30,12 +29,9 @@ func New(ctrl *movie.Controller, logger *zap.Logger) *Handler {
 func (h *Handler) GetMovieDetails(w http.ResponseWriter, req *http.Request) {
 	id := req.FormValue("id")
 	details, err := h.ctrl.Get(req.Context(), id)
-	if err != nil && errors.Is(err, gateway.ErrNotFound) {
-		w.WriteHeader(http.StatusNotFound)
-		return
-	} else if err != nil {
+	if err != nil {
 		h.logger.Warn("Repository get error", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errs.HTTPStatus(err))
 		return
 	}
 	if err := json.NewEncoder(w).Encode(details); err != nil {
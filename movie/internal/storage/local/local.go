@@ -0,0 +1,374 @@
+package local
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mmoviecom/movie/internal/storage"
+	"mmoviecom/pkg/logging"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+const tracerID = "movie-storage-local"
+
+// tempPattern defines the names of files being uploaded, which
+// are hidden from the storage until they are complete.
+const tempPattern = ".upload-*"
+
+// partPrefix defines the name prefix of the parts of resumable uploads.
+const partPrefix = ".part-"
+
+// checksumDir defines the directory of the checksums of stored files,
+// which are computed once when the files are stored.
+const checksumDir = ".sha256"
+
+// checksumLength defines the length of a hex encoded SHA-256 checksum.
+const checksumLength = 64
+
+// Storage defines a local filesystem file storage. Files are stored
+// in a root directory and cannot be read or written outside of it.
+// Files named by paths are stored in subdirectories.
+type Storage struct {
+	dir     string
+	root    *os.Root
+	maxSize int64
+	logger  *zap.Logger
+}
+
+// New creates a new local file storage of files up to maxSize bytes
+// in the dir directory, which is created if it does not exist.
+func New(dir string, maxSize int64, logger *zap.Logger) (*Storage, error) {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "storage"),
+		zap.String(logging.FieldType, "local"),
+	)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(filepath.Join(dir, checksumDir), 0o750); err != nil && !errors.Is(err, fs.ErrExist) {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{dir: dir, root: root, maxSize: maxSize, logger: logger}, nil
+}
+
+// Close closes the storage root directory.
+func (s *Storage) Close() error {
+	return s.root.Close()
+}
+
+// Put stores a file read from r. A file with the same name is replaced
+// if overwrite is true, otherwise storage.ErrAlreadyExists is returned
+// unless the stored file has the same content. The file becomes visible
+// only once it is completely written.
+func (s *Storage) Put(ctx context.Context, name string, r io.Reader, overwrite bool) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Put")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(s.dir, tempPattern)
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	blob, err := storage.Copy(f, r, s.maxSize)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.store(ctx, filepath.Base(tmp), name, blob.SHA256, overwrite)
+	}
+	if err != nil {
+		if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Warn("Failed to remove temporary file", zap.String("filename", tmp), zap.Error(err))
+		}
+		return nil, err
+	}
+	blob.Name = name
+	return blob, nil
+}
+
+// store moves a complete file, named relative to the root directory, to a
+// stored file and saves its checksum. A stored file is replaced only if
+// overwrite is true, otherwise the file is linked to its name, which fails
+// if the name exists with different content. Storing the content of a
+// stored file again succeeds, so an upload whose file was stored can be
+// retried. The checksum of a replaced file is removed first, so a missing
+// checksum is computed again rather than a stale one returned. Files are
+// placed through the root, so symlinked directories cannot redirect them
+// outside of it.
+func (s *Storage) store(ctx context.Context, src string, name string, sum string, overwrite bool) error {
+	if err := s.mkdirs(name); err != nil {
+		return err
+	}
+	if overwrite {
+		if err := s.root.Remove(s.checksumPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := s.root.Rename(src, name); err != nil {
+			return err
+		}
+	} else {
+		if err := s.root.Link(src, name); errors.Is(err, fs.ErrExist) {
+			stored, err := s.Stat(ctx, name)
+			if err != nil {
+				return err
+			}
+			if stored.SHA256 != sum {
+				return storage.ErrAlreadyExists
+			}
+		} else if err != nil {
+			return err
+		}
+		if err := s.root.Remove(src); err != nil {
+			s.logger.Warn("Failed to remove stored file source", zap.String("filename", src), zap.Error(err))
+		}
+	}
+	if err := s.writeChecksum(name, sum); err != nil {
+		s.logger.Warn("Failed to save checksum", zap.String("filename", name), zap.Error(err))
+	}
+	return nil
+}
+
+// mkdirs creates the parent directories of a stored file and of its checksum.
+func (s *Storage) mkdirs(name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	for _, base := range []string{".", checksumDir} {
+		parent := base
+		for _, d := range strings.Split(dir, "/") {
+			parent = path.Join(parent, d)
+			if err := s.root.Mkdir(parent, 0o750); err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checksumPath returns the path of the checksum of a stored file.
+func (s *Storage) checksumPath(name string) string {
+	return path.Join(checksumDir, name)
+}
+
+// writeChecksum saves the checksum of a stored file.
+func (s *Storage) writeChecksum(name string, sum string) error {
+	f, err := s.root.Create(s.checksumPath(name))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, sum)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readChecksum returns the saved checksum of a stored file.
+func (s *Storage) readChecksum(name string) (string, error) {
+	f, err := s.root.Open(s.checksumPath(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, checksumLength+1))
+	if err != nil {
+		return "", err
+	}
+	if _, err := hex.DecodeString(string(b)); err != nil || len(b) != checksumLength {
+		return "", fs.ErrInvalid
+	}
+	return string(b), nil
+}
+
+// Stat returns a stored file with the checksum saved when it was stored.
+// Files stored without a checksum are read once to compute it.
+func (s *Storage) Stat(ctx context.Context, name string) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Stat")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	f, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sum, err := s.readChecksum(name)
+	if err != nil {
+		s.logger.Info("Computing missing checksum", zap.String("filename", name), zap.Error(err))
+		blob, err := storage.Copy(io.Discard, f, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.writeChecksum(name, blob.SHA256); err != nil {
+			s.logger.Warn("Failed to save checksum", zap.String("filename", name), zap.Error(err))
+		}
+		blob.Name = name
+		return blob, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := storage.ContentType(f)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Blob{Name: name, Size: info.Size(), ContentType: contentType, SHA256: sum}, nil
+}
+
+// Open opens a stored file for reading.
+func (s *Storage) Open(ctx context.Context, name string) (io.ReadSeekCloser, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Open")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	return s.open(name)
+}
+
+// stat reads a regular file of the root directory and computes its checksum.
+func (s *Storage) stat(name string) (*storage.Blob, error) {
+	f, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return storage.Copy(io.Discard, f, 0)
+}
+
+// open opens a regular file of the root directory.
+func (s *Storage) open(name string) (*os.File, error) {
+	f, err := s.root.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Parts returns the ids of the uploads with stored parts.
+func (s *Storage) Parts(ctx context.Context) ([]string, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Parts")
+	defer span.End()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		if id, ok := strings.CutPrefix(e.Name(), partPrefix); ok && e.Type().IsRegular() {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// Append appends data read from r to a part of an upload at the offset,
+// which must be the part size, and returns the new part size. Data read
+// before an error of r is kept.
+func (s *Storage) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Append")
+	defer span.End()
+	if err := storage.ValidateName(id); err != nil {
+		return 0, err
+	}
+	f, err := s.root.OpenFile(partPrefix+id, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			s.logger.Warn("Failed to close upload part", zap.String("uploadId", id), zap.Error(err))
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return info.Size(), storage.ErrInvalidOffset
+	}
+	n, err := storage.CopyN(f, r, s.remaining(offset))
+	return offset + n, err
+}
+
+// remaining returns how many bytes can be appended to a part of a
+// given size or -1 if the size is not limited.
+func (s *Storage) remaining(size int64) int64 {
+	if s.maxSize <= 0 {
+		return -1
+	}
+	return max(s.maxSize-size, 0)
+}
+
+// StatPart returns the part of an upload as a file.
+func (s *Storage) StatPart(ctx context.Context, id string) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/StatPart")
+	defer span.End()
+	if err := storage.ValidateName(id); err != nil {
+		return nil, err
+	}
+	return s.stat(partPrefix + id)
+}
+
+// Commit stores the part of an upload as a file. A file with the same name
+// is replaced if overwrite is true. Otherwise a stored file with the same
+// content is kept in place of the part, and storage.ErrAlreadyExists is
+// returned for different content with the part kept.
+func (s *Storage) Commit(ctx context.Context, id string, name string, overwrite bool) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Commit")
+	defer span.End()
+	if err := storage.ValidateName(id); err != nil {
+		return nil, err
+	}
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	blob, err := s.stat(partPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx, partPrefix+id, name, blob.SHA256, overwrite); err != nil {
+		return nil, err
+	}
+	blob.Name = name
+	return blob, nil
+}
+
+// Abort removes the part of an upload.
+func (s *Storage) Abort(ctx context.Context, id string) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Abort")
+	defer span.End()
+	if err := storage.ValidateName(id); err != nil {
+		return err
+	}
+	if err := s.root.Remove(partPrefix + id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
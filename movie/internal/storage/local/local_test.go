@@ -0,0 +1,167 @@
+package local
+
+import (
+	"context"
+	"mmoviecom/movie/internal/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := New(filepath.Join(dir, "uploads"), 5, zap.NewNop())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	blob, err := s.Put(ctx, "poster.txt", strings.NewReader("hello"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "poster.txt", blob.Name)
+	stat, err := s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, stat)
+
+	_, err = s.Put(ctx, "poster.txt", strings.NewReader("hello!"), false)
+	assert.ErrorIs(t, err, storage.ErrTooLarge)
+	stat, err = s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, stat, "failed upload keeps the stored file")
+
+	_, err = s.Put(ctx, "poster.txt", strings.NewReader("bye"), false)
+	assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	stat, err = s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, stat, "files are not replaced implicitly")
+	again, err := s.Put(ctx, "poster.txt", strings.NewReader("hello"), false)
+	assert.NoError(t, err, "storing the same content again succeeds")
+	assert.Equal(t, blob, again)
+	replaced, err := s.Put(ctx, "poster.txt", strings.NewReader("bye"), true)
+	assert.NoError(t, err)
+	stat, err = s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, replaced, stat)
+
+	nested, err := s.Put(ctx, "movie/poster/poster.txt", strings.NewReader("hello"), false)
+	assert.NoError(t, err)
+	stat, err = s.Stat(ctx, "movie/poster/poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, nested, stat)
+
+	_, err = s.Put(ctx, "../escape.txt", strings.NewReader("hello"), false)
+	assert.ErrorIs(t, err, storage.ErrInvalidName)
+	_, err = s.Stat(ctx, "missing.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o600))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "uploads", "link.txt")))
+	_, err = s.Stat(ctx, "link.txt")
+	assert.Error(t, err, "symlinks cannot escape the root directory")
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "outside"), 0o750))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "outside"), filepath.Join(dir, "uploads", "linked")))
+	_, err = s.Put(ctx, "linked/poster.txt", strings.NewReader("hello"), false)
+	assert.Error(t, err, "files are not stored through symlinked directories")
+	_, err = os.Stat(filepath.Join(dir, "outside", "poster.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "uploads"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5, "temporary files are removed")
+}
+
+func TestStorageChecksums(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := New(dir, 0, zap.NewNop())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	blob, err := s.Put(ctx, "poster.txt", strings.NewReader("hello"), false)
+	assert.NoError(t, err)
+	sum := strings.Repeat("0", 64)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, checksumDir, "poster.txt"), []byte(sum), 0o600))
+	stat, err := s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, stat.SHA256, "the saved checksum is not computed again")
+	assert.Equal(t, blob.Size, stat.Size)
+	assert.Equal(t, blob.ContentType, stat.ContentType)
+
+	blob, err = s.Put(ctx, "poster.txt", strings.NewReader("hello, world"), true)
+	assert.NoError(t, err)
+	stat, err = s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, stat, "replacing a file replaces its checksum")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "legacy.txt"), []byte("hello"), 0o600))
+	stat, err = s.Stat(ctx, "legacy.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", stat.SHA256)
+	saved, err := os.ReadFile(filepath.Join(dir, checksumDir, "legacy.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, stat.SHA256, string(saved), "a missing checksum is saved once computed")
+}
+
+func TestStorageParts(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := New(dir, 10, zap.NewNop())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	n, err := s.Append(ctx, "upload", 0, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = s.Append(ctx, "upload", 0, strings.NewReader("hello"))
+	assert.ErrorIs(t, err, storage.ErrInvalidOffset)
+	assert.Equal(t, int64(5), n)
+	_, err = s.Stat(ctx, "poster.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "parts are not files")
+
+	n, err = s.Append(ctx, "upload", 5, strings.NewReader(", world"))
+	assert.ErrorIs(t, err, storage.ErrTooLarge)
+	assert.Equal(t, int64(10), n)
+	n, err = s.Append(ctx, "upload", 10, strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+
+	part, err := s.StatPart(ctx, "upload")
+	assert.NoError(t, err)
+	parts, err := s.Parts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"upload"}, parts)
+	blob, err := s.Commit(ctx, "upload", "poster.txt", false)
+	assert.NoError(t, err)
+	assert.Equal(t, part.SHA256, blob.SHA256)
+	stat, err := s.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, blob, stat)
+	_, err = s.StatPart(ctx, "upload")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = s.Append(ctx, "retry", 0, strings.NewReader("hello, wor"))
+	assert.NoError(t, err)
+	again, err := s.Commit(ctx, "retry", "poster.txt", false)
+	assert.NoError(t, err, "committing the same content again succeeds")
+	assert.Equal(t, blob, again)
+	_, err = s.StatPart(ctx, "retry")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.Append(ctx, "other", 0, strings.NewReader("bye"))
+	assert.NoError(t, err)
+	_, err = s.Commit(ctx, "other", "poster.txt", false)
+	assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	_, err = s.StatPart(ctx, "other")
+	assert.NoError(t, err, "parts of rejected files are kept")
+	assert.NoError(t, s.Abort(ctx, "other"))
+
+	_, err = s.Append(ctx, "aborted", 0, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Abort(ctx, "aborted"))
+	assert.NoError(t, s.Abort(ctx, "aborted"))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "aborted parts are removed")
+}
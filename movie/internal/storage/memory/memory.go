@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mmoviecom/movie/internal/storage"
+	"mmoviecom/pkg/logging"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+const tracerID = "movie-storage-memory"
+
+type entry struct {
+	data []byte
+	blob storage.Blob
+}
+
+// Storage defines a memory file storage.
+type Storage struct {
+	sync.RWMutex
+	data    map[string]entry
+	parts   map[string][]byte
+	maxSize int64
+	logger  *zap.Logger
+}
+
+// New creates a new memory file storage of files up to maxSize bytes.
+func New(maxSize int64, logger *zap.Logger) *Storage {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "storage"),
+		zap.String(logging.FieldType, "memory"),
+	)
+	return &Storage{data: map[string]entry{}, parts: map[string][]byte{}, maxSize: maxSize, logger: logger}
+}
+
+// Put stores a file read from r. A file with the same name is replaced
+// if overwrite is true, otherwise storage.ErrAlreadyExists is returned
+// unless the stored file has the same content.
+func (s *Storage) Put(ctx context.Context, name string, r io.Reader, overwrite bool) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Put")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	blob, err := storage.Copy(&buf, r, s.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	blob.Name = name
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.data[name]; ok && !overwrite {
+		if e.blob.SHA256 != blob.SHA256 {
+			return nil, storage.ErrAlreadyExists
+		}
+		return blob, nil
+	}
+	s.data[name] = entry{data: buf.Bytes(), blob: *blob}
+	return blob, nil
+}
+
+// Stat returns a stored file.
+func (s *Storage) Stat(ctx context.Context, name string) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Stat")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	e, ok := s.data[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	blob := e.blob
+	return &blob, nil
+}
+
+// Open opens a stored file for reading.
+func (s *Storage) Open(ctx context.Context, name string) (io.ReadSeekCloser, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Open")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	s.RLock()
+	defer s.RUnlock()
+	e, ok := s.data[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return nopCloser{bytes.NewReader(e.data)}, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Parts returns the ids of the uploads with stored parts.
+func (s *Storage) Parts(ctx context.Context) ([]string, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Parts")
+	defer span.End()
+	s.RLock()
+	defer s.RUnlock()
+	res := make([]string, 0, len(s.parts))
+	for id := range s.parts {
+		res = append(res, id)
+	}
+	return res, nil
+}
+
+// Append appends data read from r to a part of an upload at the offset,
+// which must be the part size, and returns the new part size. Data read
+// before an error of r is kept.
+func (s *Storage) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Append")
+	defer span.End()
+	if err := storage.ValidateName(id); err != nil {
+		return 0, err
+	}
+	s.Lock()
+	part := s.parts[id]
+	s.Unlock()
+	if int64(len(part)) != offset {
+		return int64(len(part)), storage.ErrInvalidOffset
+	}
+	buf := bytes.NewBuffer(part)
+	n := int64(-1)
+	if s.maxSize > 0 {
+		n = max(s.maxSize-offset, 0)
+	}
+	_, err := storage.CopyN(buf, r, n)
+	s.Lock()
+	defer s.Unlock()
+	s.parts[id] = buf.Bytes()
+	return int64(buf.Len()), err
+}
+
+// StatPart returns the part of an upload as a file.
+func (s *Storage) StatPart(ctx context.Context, id string) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/StatPart")
+	defer span.End()
+	s.RLock()
+	part, ok := s.parts[id]
+	s.RUnlock()
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return storage.Copy(io.Discard, bytes.NewReader(part), 0)
+}
+
+// Commit stores the part of an upload as a file. A file with the same name
+// is replaced if overwrite is true. Otherwise a stored file with the same
+// content is kept in place of the part, and storage.ErrAlreadyExists is
+// returned for different content with the part kept.
+func (s *Storage) Commit(ctx context.Context, id string, name string, overwrite bool) (*storage.Blob, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Commit")
+	defer span.End()
+	if err := storage.ValidatePath(name); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	part, ok := s.parts[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	blob, err := storage.Copy(io.Discard, bytes.NewReader(part), 0)
+	if err != nil {
+		return nil, err
+	}
+	blob.Name = name
+	if e, ok := s.data[name]; ok && !overwrite {
+		if e.blob.SHA256 != blob.SHA256 {
+			return nil, storage.ErrAlreadyExists
+		}
+	} else {
+		s.data[name] = entry{data: part, blob: *blob}
+	}
+	delete(s.parts, id)
+	return blob, nil
+}
+
+// Abort removes the part of an upload.
+func (s *Storage) Abort(ctx context.Context, id string) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Storage/Abort")
+	defer span.End()
+	s.Lock()
+	defer s.Unlock()
+	delete(s.parts, id)
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package storage defines the storage of files uploaded to the movie service.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mmoviecom/pkg/errs"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a blob is not found.
+var ErrNotFound = errs.NotFound("file not found")
+
+// ErrInvalidName is returned when a blob name is not a plain file name
+// or a path of plain file names.
+var ErrInvalidName = errs.InvalidArgument("invalid file name")
+
+// ErrAlreadyExists is returned when a blob is stored under the name
+// of a stored blob with different content without replacing it.
+var ErrAlreadyExists = errs.AlreadyExists("file already exists")
+
+// ErrTooLarge is returned when a blob exceeds the maximum size.
+var ErrTooLarge = errs.InvalidArgument("file exceeds the maximum size")
+
+// ErrInvalidOffset is returned when data is appended to a part
+// at an offset other than the part size.
+var ErrInvalidOffset = errs.InvalidArgument("invalid upload offset")
+
+// maxNameLength defines the maximum length of a blob name.
+const maxNameLength = 255
+
+// maxPathLength defines the maximum length of a blob path.
+const maxPathLength = 1024
+
+// sniffLength defines how many leading bytes determine the content type.
+const sniffLength = 512
+
+// Blob defines a stored file.
+type Blob struct {
+	Name        string
+	Size        int64
+	ContentType string
+	SHA256      string
+}
+
+// ValidateName returns ErrInvalidName unless name is a plain file name,
+// which cannot refer to a file outside of the storage. Names starting
+// with a dot are reserved for the storage.
+func ValidateName(name string) error {
+	if name == "" || len(name) > maxNameLength || name != filepath.Base(name) ||
+		strings.ContainsAny(name, `/\`+"\x00") || strings.HasPrefix(name, ".") {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// ValidatePath returns ErrInvalidName unless path is a slash separated
+// path of plain file names, which cannot refer to a file outside of the
+// storage either.
+func ValidatePath(path string) error {
+	if len(path) > maxPathLength {
+		return ErrInvalidName
+	}
+	for _, name := range strings.Split(path, "/") {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssetPath returns the path of the blob of a movie asset. The path is
+// scoped by the movie id and the asset kind, so assets of different movies
+// or kinds with the same file name are stored separately.
+func AssetPath(movieID string, kind string, filename string) (string, error) {
+	for _, name := range []string{movieID, kind, filename} {
+		if err := ValidateName(name); err != nil {
+			return "", err
+		}
+	}
+	return movieID + "/" + kind + "/" + filename, nil
+}
+
+// Copy copies a blob from r to w and returns its size, content type and
+// checksum. ErrTooLarge is returned once more than maxSize bytes are read,
+// a non-positive maxSize does not limit the size.
+func Copy(w io.Writer, r io.Reader, maxSize int64) (*Blob, error) {
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	h := sha256.New()
+	head := &headWriter{}
+	n, err := io.Copy(io.MultiWriter(w, h, head), r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && n > maxSize {
+		return nil, ErrTooLarge
+	}
+	return &Blob{
+		Size:        n,
+		ContentType: http.DetectContentType(head.buf),
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// CopyN copies up to n bytes from r to w and returns the number of copied
+// bytes. ErrTooLarge is returned if r has more data, a negative n does
+// not limit the copied bytes.
+func CopyN(w io.Writer, r io.Reader, n int64) (int64, error) {
+	if n < 0 {
+		return io.Copy(w, r)
+	}
+	written, err := io.CopyN(w, r, n)
+	if err == io.EOF {
+		return written, nil
+	} else if err != nil {
+		return written, err
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1)); err == nil {
+		return written, ErrTooLarge
+	} else if err != io.EOF {
+		return written, err
+	}
+	return written, nil
+}
+
+// ContentType returns the content type of a blob read from r,
+// determined by its leading bytes.
+func ContentType(r io.Reader) (string, error) {
+	head, err := io.ReadAll(io.LimitReader(r, sniffLength))
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head), nil
+}
+
+// headWriter keeps the leading bytes of a blob for content type sniffing.
+type headWriter struct {
+	buf []byte
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if n := sniffLength - len(w.buf); n > 0 {
+		w.buf = append(w.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"poster.png", "poster 2.jpg", "a..b"} {
+		assert.NoError(t, ValidateName(name), name)
+	}
+	for _, name := range []string{"", ".", "..", "../poster.png", "/etc/passwd", "posters/poster.png", `..\poster.png`, ".upload-1", "a\x00b", strings.Repeat("a", 256)} {
+		assert.ErrorIs(t, ValidateName(name), ErrInvalidName, name)
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	for _, path := range []string{"poster.png", "movie/poster/poster.png"} {
+		assert.NoError(t, ValidatePath(path), path)
+	}
+	for _, path := range []string{"", "movie//poster.png", "/movie/poster.png", "movie/../poster.png", "movie/.sha256/poster.png", "movie/poster.png/", strings.Repeat("a/", 513)} {
+		assert.ErrorIs(t, ValidatePath(path), ErrInvalidName, path)
+	}
+}
+
+func TestAssetPath(t *testing.T) {
+	path, err := AssetPath("movie", "poster", "poster.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "movie/poster/poster.png", path)
+	_, err = AssetPath("movie/poster", "poster", "poster.png")
+	assert.ErrorIs(t, err, ErrInvalidName)
+	_, err = AssetPath("movie", "poster", "../poster.png")
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestCopy(t *testing.T) {
+	var buf bytes.Buffer
+	blob, err := Copy(&buf, strings.NewReader("hello"), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, &Blob{
+		Size:        5,
+		ContentType: "text/plain; charset=utf-8",
+		SHA256:      "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}, blob)
+	assert.Equal(t, "hello", buf.String())
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 1024)...)
+	blob, err = Copy(&bytes.Buffer{}, bytes.NewReader(png), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", blob.ContentType)
+	assert.Equal(t, int64(len(png)), blob.Size)
+
+	_, err = Copy(&bytes.Buffer{}, strings.NewReader("hello!"), 5)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
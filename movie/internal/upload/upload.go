@@ -0,0 +1,339 @@
+// Package upload provides resumable uploads of files to the movie service.
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	metadatamodel "mmoviecom/metadata/pkg/model"
+	"mmoviecom/movie/internal/storage"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/logging"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned when an upload is not found or has expired.
+var ErrNotFound = errs.NotFound("upload not found")
+
+// ErrInvalidUpload is returned when an upload is initialized without its size or checksum.
+var ErrInvalidUpload = errs.InvalidArgument("upload size and SHA-256 checksum are required")
+
+// ErrExceedsSize is returned when more data is uploaded than declared.
+var ErrExceedsSize = errs.InvalidArgument("upload exceeds its declared size")
+
+// ErrChecksumMismatch is returned when the uploaded data does not match
+// the declared checksum. The upload is discarded.
+var ErrChecksumMismatch = errs.InvalidArgument("upload checksum mismatch")
+
+// ErrCompleted is returned when data is uploaded to a completed upload.
+var ErrCompleted = errs.InvalidArgument("upload is already completed")
+
+// expireInterval defines how often expired uploads are removed.
+const expireInterval = time.Minute
+
+type partStorage interface {
+	Parts(ctx context.Context) ([]string, error)
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	StatPart(ctx context.Context, id string) (*storage.Blob, error)
+	Commit(ctx context.Context, id string, name string, overwrite bool) (*storage.Blob, error)
+	Abort(ctx context.Context, id string) error
+}
+
+// Target defines the movie asset an upload is linked to once completed.
+// The zero value defines an upload not linked to a movie.
+type Target struct {
+	MovieID string
+	Kind    metadatamodel.AssetKind
+}
+
+// Session defines the state of an upload. Blob is set once
+// all data is received and verified. A stored file with the same
+// name is replaced only if Overwrite is true.
+type Session struct {
+	ID        string
+	Filename  string
+	Size      int64
+	SHA256    string
+	Target    Target
+	Overwrite bool
+	Received  int64
+	Blob      *storage.Blob
+}
+
+type session struct {
+	// writing serializes writes to the session.
+	writing   sync.Mutex
+	state     Session
+	updatedAt time.Time
+}
+
+// Manager defines a manager of resumable uploads. Sessions are kept in
+// memory, so an upload is resumed on the instance it was initialized on,
+// and expire after a period without writes. Uploads of a previous run
+// cannot be resumed, their data is removed by Run.
+type Manager struct {
+	sync.Mutex
+	storage  partStorage
+	maxSize  int64
+	ttl      time.Duration
+	interval time.Duration
+	sessions map[string]*session
+	now      func() time.Time
+	logger   *zap.Logger
+}
+
+// New creates a new upload manager storing uploads of files up to maxSize
+// bytes in the storage. A non-positive maxSize does not limit the size.
+func New(storage partStorage, maxSize int64, ttl time.Duration, logger *zap.Logger) *Manager {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "upload-manager"),
+	)
+	return &Manager{
+		storage:  storage,
+		maxSize:  maxSize,
+		ttl:      ttl,
+		interval: expireInterval,
+		sessions: map[string]*session{},
+		now:      time.Now,
+		logger:   logger,
+	}
+}
+
+// Run removes the data of uploads left by a previous run and then
+// removes expired uploads periodically until the context is done.
+func (m *Manager) Run(ctx context.Context) {
+	m.sweep(ctx)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.expire(ctx)
+		}
+	}
+}
+
+// sweep removes the data of uploads without sessions.
+func (m *Manager) sweep(ctx context.Context) {
+	ids, err := m.storage.Parts(ctx)
+	if err != nil {
+		m.logger.Warn("Failed to list upload data", zap.Error(err))
+		return
+	}
+	for _, id := range ids {
+		m.Lock()
+		_, ok := m.sessions[id]
+		m.Unlock()
+		if ok {
+			continue
+		}
+		m.logger.Info("Removing data of an orphaned upload", zap.String("uploadId", id))
+		if err := m.storage.Abort(ctx, id); err != nil {
+			m.logger.Warn("Failed to remove upload data", zap.String("uploadId", id), zap.Error(err))
+		}
+	}
+}
+
+// Init starts an upload of a file of a given size and SHA-256 checksum,
+// which replaces a stored file with the same name if overwrite is true.
+// The target is kept with the upload and is not validated.
+func (m *Manager) Init(_ context.Context, filename string, size int64, sha256 string, target Target, overwrite bool) (*Session, error) {
+	if err := storage.ValidatePath(filename); err != nil {
+		return nil, err
+	}
+	if b, err := hex.DecodeString(sha256); err != nil || len(b) != 32 || size <= 0 {
+		return nil, ErrInvalidUpload
+	}
+	if m.maxSize > 0 && size > m.maxSize {
+		return nil, storage.ErrTooLarge
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s := &session{
+		state:     Session{ID: id, Filename: filename, Size: size, SHA256: strings.ToLower(sha256), Target: target, Overwrite: overwrite},
+		updatedAt: m.now(),
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.sessions[id] = s
+	res := s.state
+	return &res, nil
+}
+
+// Status returns the state of an upload.
+func (m *Manager) Status(_ context.Context, id string) (*Session, error) {
+	m.Lock()
+	defer m.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || m.expired(s) {
+		return nil, ErrNotFound
+	}
+	res := s.state
+	return &res, nil
+}
+
+// Write appends data read from r to an upload at the offset, which must
+// be the number of bytes received so far. Data read before an error of r
+// is kept, so the upload can be resumed. Once all data is received, it is
+// verified and stored as the upload file. The state of the upload is
+// returned along with any error.
+func (m *Manager) Write(ctx context.Context, id string, offset int64, r io.Reader) (*Session, error) {
+	m.Lock()
+	s, ok := m.sessions[id]
+	if !ok || m.expired(s) {
+		m.Unlock()
+		return nil, ErrNotFound
+	}
+	m.Unlock()
+
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	m.Lock()
+	// The session may have expired while waiting for another write.
+	removed := m.sessions[id] != s
+	m.Unlock()
+	if removed {
+		return nil, ErrNotFound
+	}
+	state := m.state(s)
+	if state.Blob != nil {
+		return state, ErrCompleted
+	}
+	if offset != state.Received {
+		return state, storage.ErrInvalidOffset
+	}
+	received, err := m.storage.Append(ctx, id, offset, &sizeLimitReader{r: r, n: state.Size - offset})
+	m.Lock()
+	s.state.Received = received
+	s.updatedAt = m.now()
+	m.Unlock()
+	if err != nil || received < state.Size {
+		return m.state(s), err
+	}
+	return m.complete(ctx, s)
+}
+
+// complete verifies the received data of an upload and stores it.
+// Callers must hold the session writing lock.
+func (m *Manager) complete(ctx context.Context, s *session) (*Session, error) {
+	state := m.state(s)
+	part, err := m.storage.StatPart(ctx, state.ID)
+	if err != nil {
+		return state, err
+	}
+	if part.SHA256 != state.SHA256 {
+		m.logger.Warn("Discarding upload with checksum mismatch",
+			zap.String("uploadId", state.ID),
+			zap.String("filename", state.Filename),
+		)
+		m.remove(ctx, state.ID)
+		return nil, ErrChecksumMismatch
+	}
+	blob, err := m.storage.Commit(ctx, state.ID, state.Filename, state.Overwrite)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		m.logger.Warn("Discarding upload of an existing file",
+			zap.String("uploadId", state.ID),
+			zap.String("filename", state.Filename),
+		)
+		m.remove(ctx, state.ID)
+		return nil, err
+	} else if err != nil {
+		return state, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	s.state.Blob = blob
+	res := s.state
+	return &res, nil
+}
+
+func (m *Manager) state(s *session) *Session {
+	m.Lock()
+	defer m.Unlock()
+	res := s.state
+	return &res
+}
+
+// expired reports whether a session has expired.
+// Callers must hold the manager lock.
+func (m *Manager) expired(s *session) bool {
+	return m.ttl > 0 && m.now().Sub(s.updatedAt) > m.ttl
+}
+
+// expire removes expired sessions and their data. Sessions being written
+// are skipped, their writes refresh them once done.
+func (m *Manager) expire(ctx context.Context) {
+	m.Lock()
+	var ids []string
+	for id, s := range m.sessions {
+		if m.expired(s) && s.writing.TryLock() {
+			delete(m.sessions, id)
+			s.writing.Unlock()
+			ids = append(ids, id)
+		}
+	}
+	m.Unlock()
+	for _, id := range ids {
+		m.abort(ctx, id)
+	}
+}
+
+// Discard removes an upload and its data, so it is no longer found.
+// Completed uploads whose file cannot be used are discarded to be
+// started again rather than reported as completed.
+func (m *Manager) Discard(ctx context.Context, id string) {
+	m.remove(ctx, id)
+}
+
+// remove removes a session and its data.
+func (m *Manager) remove(ctx context.Context, id string) {
+	m.Lock()
+	delete(m.sessions, id)
+	m.Unlock()
+	m.abort(ctx, id)
+}
+
+// abort removes the data of an upload.
+func (m *Manager) abort(ctx context.Context, id string) {
+	if err := m.storage.Abort(ctx, id); err != nil {
+		m.logger.Warn("Failed to remove upload data", zap.String("uploadId", id), zap.Error(err))
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sizeLimitReader reads up to n bytes and returns ErrExceedsSize if
+// the underlying reader has more data.
+type sizeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		if _, err := io.ReadFull(r.r, make([]byte, 1)); err != nil {
+			return 0, err
+		}
+		return 0, ErrExceedsSize
+	}
+	p = p[:min(int64(len(p)), r.n)]
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,206 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	metadatamodel "mmoviecom/metadata/pkg/model"
+	"mmoviecom/movie/internal/storage"
+	"mmoviecom/movie/internal/storage/memory"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var errDropped = errors.New("connection dropped")
+
+// droppingReader returns the data of r and then errDropped.
+type droppingReader struct {
+	r io.Reader
+}
+
+func (r *droppingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return n, errDropped
+	}
+	return n, err
+}
+
+func checksum(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+func TestManagerResume(t *testing.T) {
+	ctx := context.Background()
+	fileStorage := memory.New(0, zap.NewNop())
+	m := New(fileStorage, 0, time.Hour, zap.NewNop())
+	data := "hello, world"
+
+	target := Target{MovieID: "id", Kind: metadatamodel.AssetKindPoster}
+	s, err := m.Init(ctx, "poster.txt", int64(len(data)), checksum(data), target, false)
+	assert.NoError(t, err)
+
+	s, err = m.Write(ctx, s.ID, 0, &droppingReader{r: strings.NewReader(data[:5])})
+	assert.ErrorIs(t, err, errDropped)
+	assert.Equal(t, int64(5), s.Received, "data before the interruption is kept")
+
+	_, err = m.Write(ctx, s.ID, 0, strings.NewReader(data))
+	assert.ErrorIs(t, err, storage.ErrInvalidOffset)
+
+	status, err := m.Status(ctx, s.ID)
+	assert.NoError(t, err)
+	s, err = m.Write(ctx, s.ID, status.Received, strings.NewReader(data[status.Received:]))
+	assert.NoError(t, err)
+	assert.NotNil(t, s.Blob)
+	assert.Equal(t, checksum(data), s.Blob.SHA256)
+	assert.Equal(t, target, s.Target, "the target is kept with the upload")
+
+	blob, err := fileStorage.Stat(ctx, "poster.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), blob.Size)
+
+	_, err = m.Write(ctx, s.ID, s.Received, strings.NewReader("more"))
+	assert.ErrorIs(t, err, ErrCompleted)
+
+	m.Discard(ctx, s.ID)
+	_, err = m.Status(ctx, s.ID)
+	assert.ErrorIs(t, err, ErrNotFound, "discarded uploads are removed")
+	s, err = m.Init(ctx, "poster.txt", int64(len(data)), checksum(data), target, false)
+	assert.NoError(t, err)
+	s, err = m.Write(ctx, s.ID, 0, strings.NewReader(data))
+	assert.NoError(t, err, "an upload of the stored file can be retried")
+	assert.Equal(t, checksum(data), s.Blob.SHA256)
+}
+
+func TestManagerErrors(t *testing.T) {
+	ctx := context.Background()
+	fileStorage := memory.New(0, zap.NewNop())
+	m := New(fileStorage, 0, time.Hour, zap.NewNop())
+	now := time.Unix(0, 0)
+	m.now = func() time.Time { return now }
+
+	_, err := m.Init(ctx, "../poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.ErrorIs(t, err, storage.ErrInvalidName)
+	_, err = m.Init(ctx, "poster.txt", 5, "checksum", Target{}, false)
+	assert.ErrorIs(t, err, ErrInvalidUpload)
+	_, err = m.Init(ctx, "poster.txt", 0, checksum("hello"), Target{}, false)
+	assert.ErrorIs(t, err, ErrInvalidUpload)
+	m.maxSize = 4
+	_, err = m.Init(ctx, "poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.ErrorIs(t, err, storage.ErrTooLarge)
+	m.maxSize = 0
+
+	s, err := m.Init(ctx, "poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.NoError(t, err)
+	s, err = m.Write(ctx, s.ID, 0, strings.NewReader("hello!"))
+	assert.ErrorIs(t, err, ErrExceedsSize)
+	assert.Equal(t, int64(5), s.Received)
+
+	s, err = m.Init(ctx, "poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.NoError(t, err)
+	_, err = m.Write(ctx, s.ID, 0, strings.NewReader("HELLO"))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = m.Status(ctx, s.ID)
+	assert.ErrorIs(t, err, ErrNotFound, "mismatching upload is discarded")
+	_, err = fileStorage.Stat(ctx, "poster.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = fileStorage.Put(ctx, "existing.txt", strings.NewReader("bye"), false)
+	assert.NoError(t, err)
+	s, err = m.Init(ctx, "existing.txt", 5, checksum("hello"), Target{}, false)
+	assert.NoError(t, err)
+	_, err = m.Write(ctx, s.ID, 0, strings.NewReader("hello"))
+	assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	_, err = m.Status(ctx, s.ID)
+	assert.ErrorIs(t, err, ErrNotFound, "upload of an existing file is discarded")
+	blob, err := fileStorage.Stat(ctx, "existing.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, checksum("bye"), blob.SHA256, "files are not replaced implicitly")
+
+	s, err = m.Init(ctx, "poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = m.Status(ctx, s.ID)
+	assert.ErrorIs(t, err, ErrNotFound, "upload expires")
+	_, err = m.Write(ctx, s.ID, 0, strings.NewReader("hello"))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManagerRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fileStorage := memory.New(0, zap.NewNop())
+	_, err := fileStorage.Append(ctx, "orphan", 0, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	m := New(fileStorage, 0, time.Hour, zap.NewNop())
+	m.interval = time.Millisecond
+	var now atomic.Int64
+	m.now = func() time.Time { return time.Unix(now.Load(), 0) }
+	s, err := m.Init(ctx, "poster.txt", 10, checksum("hello, world"), Target{}, false)
+	assert.NoError(t, err)
+	_, err = m.Write(ctx, s.ID, 0, strings.NewReader("hello"))
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := fileStorage.StatPart(ctx, "orphan")
+		return errors.Is(err, storage.ErrNotFound)
+	}, time.Second, time.Millisecond, "data of uploads without sessions is removed")
+	_, err = fileStorage.StatPart(ctx, s.ID)
+	assert.NoError(t, err, "data of active uploads is kept")
+
+	now.Store(int64((2 * time.Hour).Seconds()))
+	assert.Eventually(t, func() bool {
+		_, err := fileStorage.StatPart(ctx, s.ID)
+		return errors.Is(err, storage.ErrNotFound)
+	}, time.Second, time.Millisecond, "data of expired uploads is removed periodically")
+
+	cancel()
+	<-done
+}
+
+func TestManagerExpireSkipsWrites(t *testing.T) {
+	ctx := context.Background()
+	fileStorage := memory.New(0, zap.NewNop())
+	m := New(fileStorage, 0, time.Hour, zap.NewNop())
+	var now atomic.Int64
+	m.now = func() time.Time { return time.Unix(now.Load(), 0) }
+	s, err := m.Init(ctx, "poster.txt", 5, checksum("hello"), Target{}, false)
+	assert.NoError(t, err)
+
+	r, w := io.Pipe()
+	type result struct {
+		s   *Session
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		s, err := m.Write(ctx, s.ID, 0, r)
+		done <- result{s, err}
+	}()
+	_, err = w.Write([]byte("hel"))
+	assert.NoError(t, err)
+	now.Store(int64((2 * time.Hour).Seconds()))
+	m.expire(ctx)
+	_, err = w.Write([]byte("lo"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	res := <-done
+	assert.NoError(t, res.err, "uploads are not expired while being written")
+	if assert.NotNil(t, res.s) {
+		assert.NotNil(t, res.s.Blob)
+	}
+}
@@ -1,9 +1,28 @@
 package model
 
-import "mmoviecom/metadata/pkg/model"
+import (
+	"mmoviecom/gen"
+	"mmoviecom/metadata/pkg/model"
+)
 
 // MovieDetails includes movie metadata its aggregated rating.
+// Degraded is set when the rating could not be retrieved.
 type MovieDetails struct {
 	Rating   *float64       `json:"rating,omitempty"`
 	Metadata model.Metadata `json:"metadata"`
+	Degraded bool           `json:"degraded,omitempty"`
+}
+
+// MovieDetailsToProto converts a MovieDetails struct into a
+// generated proto counterpart. A missing rating is converted to zero.
+func MovieDetailsToProto(d *MovieDetails) *gen.MovieDetails {
+	var rating float64
+	if d.Rating != nil {
+		rating = *d.Rating
+	}
+	return &gen.MovieDetails{
+		Metadata: model.MetadataToProto(&d.Metadata),
+		Rating:   rating,
+		Degraded: d.Degraded,
+	}
 }
@@ -2,12 +2,20 @@ package testutil
 
 import (
 	"mmoviecom/gen"
+	"mmoviecom/internal/grpcutil"
+	"mmoviecom/movie/configs"
 	"mmoviecom/movie/internal/controller/movie"
+	authgateway "mmoviecom/movie/internal/gateway/auth/grpc"
 	metadatagateway "mmoviecom/movie/internal/gateway/metadata/grpc"
 	ratinggateway "mmoviecom/movie/internal/gateway/rating/grpc"
 	"mmoviecom/movie/internal/handler/grpc"
+	"mmoviecom/movie/internal/storage/memory"
+	"mmoviecom/movie/internal/upload"
+	"mmoviecom/pkg/breaker"
 	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/hedge"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 
 	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
@@ -18,8 +26,14 @@ func NewTestMovieGRPCServer(registry discovery.Registry, logger *zap.Logger, sco
 	logger = logger.With(
 		zap.String(logging.FieldService, "movie"),
 	)
-	m := metadatagateway.New(registry, insecure.NewCredentials(), logger)
-	r := ratinggateway.New(registry, insecure.NewCredentials(), logger)
-	ctrl := movie.New(r, m, logger)
-	return grpc.New(ctrl, logger, scope)
+	pool, err := grpcutil.NewConnPool(registry, insecure.NewCredentials(), nil)
+	if err != nil {
+		logger.Fatal("Failed to create gRPC connection pool", zap.Error(err))
+	}
+	m := metadatagateway.New(pool, breaker.New("metadata", breaker.Config{}, logger, scope), retry.New("metadata", retry.Config{}, logger, scope), hedge.New("metadata", hedge.Config{}, logger, scope), logger)
+	r := ratinggateway.New(pool, breaker.New("rating", breaker.Config{}, logger, scope), retry.New("rating", retry.Config{}, logger, scope), hedge.New("rating", hedge.Config{}, logger, scope), logger)
+	a := authgateway.New(pool, breaker.New("auth", breaker.Config{}, logger, scope), retry.New("auth", retry.Config{}, logger, scope), logger)
+	ctrl := movie.New(r, m, a, configs.TimeoutsConfig{}, configs.CacheConfig{}, logger, scope)
+	fileStorage := memory.New(0, logger)
+	return grpc.New(ctrl, fileStorage, upload.New(fileStorage, 0, 0, logger), logger, scope)
 }
@@ -0,0 +1,187 @@
+// Package breaker provides a circuit breaker for calls to other services.
+package breaker
+
+import (
+	"context"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/logging"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrOpen is returned when a call is rejected by an open circuit breaker.
+var ErrOpen = errs.Unavailable("circuit breaker is open")
+
+// State defines a circuit breaker state.
+type State int
+
+// Circuit breaker states.
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Config defines a circuit breaker configuration. The breaker opens after
+// FailureThreshold consecutive failures and rejects calls for CoolDown.
+// It then lets HalfOpenRequests trial calls through, closing on their
+// success and opening again on any failure. A zero FailureThreshold
+// disables the breaker.
+type Config struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	CoolDown         time.Duration `yaml:"coolDown"`
+	HalfOpenRequests int           `yaml:"halfOpenRequests" default:"1"`
+}
+
+// Breaker defines a circuit breaker.
+type Breaker struct {
+	sync.Mutex
+	cfg        Config
+	state      State
+	failures   int
+	openedAt   time.Time
+	trials     int
+	successes  int
+	now        func() time.Time
+	logger     *zap.Logger
+	stateGauge tally.Gauge
+	rejected   tally.Counter
+	scope      tally.Scope
+}
+
+// New creates a new circuit breaker of calls to a named dependency.
+func New(name string, cfg Config, logger *zap.Logger, scope tally.Scope) *Breaker {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "circuit-breaker"),
+		zap.String("breaker", name),
+	)
+	scope = scope.Tagged(map[string]string{
+		"component": "circuit_breaker",
+		"breaker":   name,
+	})
+	cfg.HalfOpenRequests = max(cfg.HalfOpenRequests, 1)
+	b := &Breaker{
+		cfg:        cfg,
+		now:        time.Now,
+		logger:     logger,
+		stateGauge: scope.Gauge("state"),
+		rejected:   scope.Counter("rejected"),
+		scope:      scope,
+	}
+	b.stateGauge.Update(float64(StateClosed))
+	return b
+}
+
+// Do calls fn unless the breaker is open, in which case ErrOpen is returned.
+// Unavailable and internal errors of fn are counted as failures, other
+// domain errors and cancellations are not.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.allow() {
+		b.rejected.Inc(1)
+		return ErrOpen
+	}
+	err := fn(ctx)
+	b.record(isFailure(err))
+	return err
+}
+
+// State returns the current breaker state.
+func (b *Breaker) State() State {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+func (b *Breaker) allow() bool {
+	if b.cfg.FailureThreshold <= 0 {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.cfg.CoolDown {
+			return false
+		}
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+func (b *Breaker) record(failure bool) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case StateClosed:
+		if !failure {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if failure {
+			b.setState(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// setState moves the breaker to a new state. Callers must hold the breaker lock.
+func (b *Breaker) setState(state State) {
+	b.logger.Warn("Circuit breaker state changed",
+		zap.Stringer("from", b.state),
+		zap.Stringer("to", state),
+		zap.Int("failures", b.failures),
+	)
+	b.state = state
+	b.failures = 0
+	b.trials = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+	b.stateGauge.Update(float64(state))
+	b.scope.Tagged(map[string]string{"to": state.String()}).Counter("transitions").Inc(1)
+}
+
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch errs.KindOf(err) {
+	case errs.KindInternal, errs.KindUnavailable:
+		return errs.GRPCCode(err) != codes.Canceled
+	default:
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"mmoviecom/pkg/errs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := New("test", Config{FailureThreshold: 2, CoolDown: time.Second}, zap.NewNop(), tally.NoopScope)
+	b.now = func() time.Time { return now }
+	call := func(err error) func(context.Context) error {
+		return func(context.Context) error { return err }
+	}
+	unavailable := errs.Unavailable("unavailable")
+
+	assert.ErrorIs(t, b.Do(ctx, call(errs.NotFound("not found"))), errs.ErrNotFound)
+	assert.ErrorIs(t, b.Do(ctx, call(errs.NotFound("not found"))), errs.ErrNotFound)
+	assert.Equal(t, StateClosed, b.State(), "domain errors are not failures")
+
+	assert.Equal(t, unavailable, b.Do(ctx, call(unavailable)))
+	assert.NoError(t, b.Do(ctx, call(nil)))
+	assert.Equal(t, unavailable, b.Do(ctx, call(unavailable)))
+	assert.Equal(t, StateClosed, b.State(), "failures must be consecutive")
+
+	assert.Error(t, b.Do(ctx, call(errors.New("connection refused"))))
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, ErrOpen, b.Do(ctx, call(nil)), "open breaker rejects calls")
+
+	now = now.Add(time.Second)
+	assert.Equal(t, unavailable, b.Do(ctx, call(unavailable)))
+	assert.Equal(t, StateOpen, b.State(), "failed trial call opens the breaker")
+
+	now = now.Add(time.Second)
+	assert.NoError(t, b.Do(ctx, call(nil)))
+	assert.Equal(t, StateClosed, b.State(), "successful trial call closes the breaker")
+}
+
+func TestBreakerHalfOpenRequests(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := New("test", Config{FailureThreshold: 1, CoolDown: time.Second, HalfOpenRequests: 2}, zap.NewNop(), tally.NoopScope)
+	b.now = func() time.Time { return now }
+	assert.Error(t, b.Do(ctx, func(context.Context) error { return errs.Unavailable("unavailable") }))
+
+	now = now.Add(time.Second)
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	for range 2 {
+		go func() {
+			done <- b.Do(ctx, func(context.Context) error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		b.Lock()
+		defer b.Unlock()
+		return b.trials == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.Equal(t, ErrOpen, b.Do(ctx, func(context.Context) error { return nil }), "only HalfOpenRequests trial calls are allowed")
+	close(release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := New("test", Config{}, zap.NewNop(), tally.NoopScope)
+	for range 10 {
+		assert.Error(t, b.Do(context.Background(), func(context.Context) error { return errors.New("failure") }))
+	}
+	assert.Equal(t, StateClosed, b.State())
+}
@@ -0,0 +1,240 @@
+// Package errs defines domain errors shared by the services and their
+// mapping to gRPC status codes and HTTP statuses.
+package errs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kind defines a kind of domain error.
+type Kind int
+
+// Domain error kinds. KindInternal is the kind of any error
+// that is not a domain error.
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindInvalidArgument
+	KindUnauthenticated
+	KindPermissionDenied
+	KindUnavailable
+	KindAlreadyExists
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindInvalidArgument:
+		return "invalid argument"
+	case KindUnauthenticated:
+		return "unauthenticated"
+	case KindPermissionDenied:
+		return "permission denied"
+	case KindUnavailable:
+		return "unavailable"
+	case KindAlreadyExists:
+		return "already exists"
+	default:
+		return "internal"
+	}
+}
+
+// Error defines a domain error of a given kind.
+type Error struct {
+	kind Kind
+	msg  string
+	err  error
+	// anyOfKind marks errors matching any error of their kind.
+	anyOfKind bool
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target matches any error of the error kind,
+// so errors.Is(err, ErrNotFound) is true for every not found error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.anyOfKind && t.kind == e.kind
+}
+
+// Kind returns the error kind.
+func (e *Error) Kind() Kind {
+	return e.kind
+}
+
+// Errors matching any domain error of their kind.
+var (
+	ErrNotFound         = anyOf(KindNotFound)
+	ErrInvalidArgument  = anyOf(KindInvalidArgument)
+	ErrUnauthenticated  = anyOf(KindUnauthenticated)
+	ErrPermissionDenied = anyOf(KindPermissionDenied)
+	ErrUnavailable      = anyOf(KindUnavailable)
+	ErrAlreadyExists    = anyOf(KindAlreadyExists)
+)
+
+func anyOf(kind Kind) *Error {
+	return &Error{kind: kind, msg: kind.String(), anyOfKind: true}
+}
+
+// New creates a new domain error.
+func New(kind Kind, msg string) *Error {
+	return &Error{kind: kind, msg: msg}
+}
+
+// NotFound creates a new not found error.
+func NotFound(msg string) *Error {
+	return New(KindNotFound, msg)
+}
+
+// InvalidArgument creates a new invalid argument error.
+func InvalidArgument(msg string) *Error {
+	return New(KindInvalidArgument, msg)
+}
+
+// Unauthenticated creates a new unauthenticated error.
+func Unauthenticated(msg string) *Error {
+	return New(KindUnauthenticated, msg)
+}
+
+// PermissionDenied creates a new permission denied error.
+func PermissionDenied(msg string) *Error {
+	return New(KindPermissionDenied, msg)
+}
+
+// Unavailable creates a new unavailable error.
+func Unavailable(msg string) *Error {
+	return New(KindUnavailable, msg)
+}
+
+// AlreadyExists creates a new already exists error.
+func AlreadyExists(msg string) *Error {
+	return New(KindAlreadyExists, msg)
+}
+
+// KindOf returns the kind of the first domain error in the err chain
+// or KindInternal if there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.kind
+	}
+	return KindInternal
+}
+
+// GRPCCode returns the gRPC status code of an error. Errors that are
+// not domain errors keep their own gRPC status code, if any.
+func GRPCCode(err error) codes.Code {
+	switch KindOf(err) {
+	case KindNotFound:
+		return codes.NotFound
+	case KindInvalidArgument:
+		return codes.InvalidArgument
+	case KindUnauthenticated:
+		return codes.Unauthenticated
+	case KindPermissionDenied:
+		return codes.PermissionDenied
+	case KindUnavailable:
+		return codes.Unavailable
+	case KindAlreadyExists:
+		return codes.AlreadyExists
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	} else if errors.Is(err, context.Canceled) {
+		return codes.Canceled
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return codes.Internal
+}
+
+// ToGRPC converts an error into a gRPC status error.
+func ToGRPC(err error) error {
+	if err == nil {
+		return nil
+	}
+	return status.Error(GRPCCode(err), err.Error())
+}
+
+// FromGRPC converts a gRPC status error into a domain error. Status codes
+// without a matching kind are returned unchanged.
+func FromGRPC(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var kind Kind
+	switch s.Code() {
+	case codes.NotFound:
+		kind = KindNotFound
+	case codes.InvalidArgument:
+		kind = KindInvalidArgument
+	case codes.Unauthenticated:
+		kind = KindUnauthenticated
+	case codes.PermissionDenied:
+		kind = KindPermissionDenied
+	case codes.Unavailable:
+		kind = KindUnavailable
+	case codes.AlreadyExists:
+		kind = KindAlreadyExists
+	default:
+		return err
+	}
+	return &Error{kind: kind, msg: s.Message(), err: err}
+}
+
+// HTTPStatus returns the HTTP status of an error.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindInvalidArgument:
+		return http.StatusBadRequest
+	case KindUnauthenticated:
+		return http.StatusUnauthorized
+	case KindPermissionDenied:
+		return http.StatusForbidden
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	case KindAlreadyExists:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FromHTTPStatus converts a non-2xx HTTP status into a domain error.
+// Statuses without a matching kind are returned as internal errors.
+func FromHTTPStatus(code int, msg string) error {
+	switch code {
+	case http.StatusNotFound:
+		return NotFound(msg)
+	case http.StatusBadRequest:
+		return InvalidArgument(msg)
+	case http.StatusUnauthorized:
+		return Unauthenticated(msg)
+	case http.StatusForbidden:
+		return PermissionDenied(msg)
+	case http.StatusConflict:
+		return AlreadyExists(msg)
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return Unavailable(msg)
+	default:
+		return errors.New(msg)
+	}
+}
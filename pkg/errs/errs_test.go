@@ -0,0 +1,95 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantKind   Kind
+		wantCode   codes.Code
+		wantStatus int
+		wantIs     error
+	}{
+		{
+			name:       "not found",
+			err:        NotFound("rating not found"),
+			wantKind:   KindNotFound,
+			wantCode:   codes.NotFound,
+			wantStatus: http.StatusNotFound,
+			wantIs:     ErrNotFound,
+		},
+		{
+			name:       "wrapped invalid argument",
+			err:        fmt.Errorf("%w: %w", InvalidArgument("invalid rating"), errors.New("value out of range")),
+			wantKind:   KindInvalidArgument,
+			wantCode:   codes.InvalidArgument,
+			wantStatus: http.StatusBadRequest,
+			wantIs:     ErrInvalidArgument,
+		},
+		{
+			name:       "unauthenticated",
+			err:        Unauthenticated("token is empty"),
+			wantKind:   KindUnauthenticated,
+			wantCode:   codes.Unauthenticated,
+			wantStatus: http.StatusUnauthorized,
+			wantIs:     ErrUnauthenticated,
+		},
+		{
+			name:       "unavailable",
+			err:        Unavailable("rating service unavailable"),
+			wantKind:   KindUnavailable,
+			wantCode:   codes.Unavailable,
+			wantStatus: http.StatusServiceUnavailable,
+			wantIs:     ErrUnavailable,
+		},
+		{
+			name:       "already exists",
+			err:        AlreadyExists("movie already exists"),
+			wantKind:   KindAlreadyExists,
+			wantCode:   codes.AlreadyExists,
+			wantStatus: http.StatusConflict,
+			wantIs:     ErrAlreadyExists,
+		},
+		{
+			name:       "internal",
+			err:        errors.New("connection reset"),
+			wantKind:   KindInternal,
+			wantCode:   codes.Internal,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantKind, KindOf(tt.err), tt.name)
+			assert.Equal(t, tt.wantCode, GRPCCode(tt.err), tt.name)
+			assert.Equal(t, tt.wantStatus, HTTPStatus(tt.err), tt.name)
+			if tt.wantIs != nil {
+				assert.ErrorIs(t, tt.err, tt.wantIs, tt.name)
+				assert.ErrorIs(t, FromGRPC(ToGRPC(tt.err)), tt.wantIs, tt.name)
+				assert.ErrorIs(t, FromHTTPStatus(HTTPStatus(tt.err), tt.err.Error()), tt.wantIs, tt.name)
+			}
+			for _, other := range []error{ErrNotFound, ErrInvalidArgument, ErrUnauthenticated, ErrPermissionDenied, ErrUnavailable, ErrAlreadyExists} {
+				if other != tt.wantIs {
+					assert.NotErrorIs(t, tt.err, other, tt.name)
+				}
+			}
+		})
+	}
+}
+
+func TestFromGRPCKeepsUnmappedCodes(t *testing.T) {
+	err := status.Error(codes.ResourceExhausted, "rate limited")
+	assert.Equal(t, err, FromGRPC(err))
+	assert.Equal(t, codes.ResourceExhausted, GRPCCode(err))
+}
@@ -0,0 +1,153 @@
+// Package hedge provides hedged requests, which send a second attempt of
+// a slow read-only call and take the first success.
+package hedge
+
+import (
+	"context"
+	"math"
+	"mmoviecom/pkg/logging"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+const (
+	// latencyWindow defines how many recent call latencies are kept.
+	latencyWindow = 200
+	// minSamples defines how many latencies are needed for a percentile delay.
+	minSamples = 20
+)
+
+// Config defines a hedging policy. A hedged attempt is sent when the first
+// one has not completed after Delay or, once enough calls were observed,
+// after the Percentile (between 0 and 1) of recent call latencies.
+// A zero Delay and Percentile disable hedging.
+type Config struct {
+	Delay      time.Duration `yaml:"delay"`
+	Percentile float64       `yaml:"percentile"`
+}
+
+// Hedger defines a hedger of calls to a named dependency.
+type Hedger struct {
+	sync.Mutex
+	cfg       Config
+	latencies []time.Duration
+	next      int
+	logger    *zap.Logger
+	hedges    tally.Counter
+	wins      tally.Counter
+}
+
+// New creates a new hedger of calls to a named dependency.
+func New(name string, cfg Config, logger *zap.Logger, scope tally.Scope) *Hedger {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "hedger"),
+		zap.String("hedger", name),
+	)
+	scope = scope.Tagged(map[string]string{
+		"component": "hedger",
+		"hedger":    name,
+	})
+	return &Hedger{
+		cfg:    cfg,
+		logger: logger,
+		hedges: scope.Counter("hedges"),
+		wins:   scope.Counter("hedge_wins"),
+	}
+}
+
+// Do calls fn and, if it is still running after the hedging delay, calls
+// it again concurrently. The first successful result is returned and the
+// other attempt is canceled. With client-side load balancing the hedged
+// attempt is sent to another service instance. fn must be safe to call
+// twice, so only read-only calls should be hedged.
+func Do[T any](ctx context.Context, h *Hedger, fn func(ctx context.Context) (T, error)) (T, error) {
+	delay, ok := h.delay()
+	if !ok {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		v      T
+		err    error
+		hedged bool
+	}
+	results := make(chan result, 2)
+	attempt := func(hedged bool) {
+		v, err := fn(ctx)
+		results <- result{v: v, err: err, hedged: hedged}
+	}
+	start := time.Now()
+	go attempt(false)
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedge := timer.C
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			h.hedges.Inc(1)
+			h.logger.Debug("Sending hedged request", zap.Duration("delay", delay))
+			pending++
+			go attempt(true)
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if r.hedged {
+					h.wins.Inc(1)
+				}
+				h.observe(time.Since(start))
+				return r.v, nil
+			}
+			// A failure before the hedging delay is returned to the caller,
+			// which may retry it, instead of being hedged.
+			if pending == 0 {
+				return r.v, r.err
+			}
+		}
+	}
+}
+
+// delay returns the hedging delay or false if hedging is disabled.
+func (h *Hedger) delay() (time.Duration, bool) {
+	if h.cfg.Percentile > 0 {
+		if d, ok := h.percentile(); ok {
+			return d, true
+		}
+	}
+	return h.cfg.Delay, h.cfg.Delay > 0
+}
+
+// percentile returns the configured percentile of recent call latencies.
+func (h *Hedger) percentile() (time.Duration, bool) {
+	h.Lock()
+	latencies := slices.Clone(h.latencies)
+	h.Unlock()
+	if len(latencies) < minSamples {
+		return 0, false
+	}
+	slices.Sort(latencies)
+	i := int(math.Ceil(min(h.cfg.Percentile, 1)*float64(len(latencies)))) - 1
+	return latencies[max(i, 0)], true
+}
+
+// observe records the latency of a successful call.
+func (h *Hedger) observe(latency time.Duration) {
+	if h.cfg.Percentile <= 0 {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if len(h.latencies) < latencyWindow {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % latencyWindow
+}
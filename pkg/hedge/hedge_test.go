@@ -0,0 +1,119 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+func TestDo(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name         string
+		cfg          Config
+		latencies    []time.Duration
+		errs         []error
+		want         int
+		wantErr      error
+		wantAttempts int32
+	}{
+		{
+			name:         "disabled",
+			latencies:    []time.Duration{20 * time.Millisecond},
+			errs:         []error{nil},
+			want:         0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "fast first attempt",
+			cfg:          Config{Delay: time.Second},
+			latencies:    []time.Duration{0},
+			errs:         []error{nil},
+			want:         0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "hedged attempt wins",
+			cfg:          Config{Delay: 5 * time.Millisecond},
+			latencies:    []time.Duration{time.Second, 0},
+			errs:         []error{nil, nil},
+			want:         1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "first attempt fails before delay",
+			cfg:          Config{Delay: time.Second},
+			latencies:    []time.Duration{0},
+			errs:         []error{errFailed},
+			wantErr:      errFailed,
+			wantAttempts: 1,
+		},
+		{
+			name:         "hedged attempt fails",
+			cfg:          Config{Delay: 5 * time.Millisecond},
+			latencies:    []time.Duration{50 * time.Millisecond, 0},
+			errs:         []error{nil, errFailed},
+			want:         0,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New("test", tt.cfg, zap.NewNop(), tally.NoopScope)
+			var attempts atomic.Int32
+			got, err := Do(context.Background(), h, func(ctx context.Context) (int, error) {
+				i := int(attempts.Add(1)) - 1
+				select {
+				case <-time.After(tt.latencies[i]):
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				}
+				return i, tt.errs[i]
+			})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestDoCancelsSlowAttempt(t *testing.T) {
+	h := New("test", Config{Delay: time.Millisecond}, zap.NewNop(), tally.NoopScope)
+	var attempts atomic.Int32
+	canceled := make(chan struct{})
+	_, err := Do(context.Background(), h, func(ctx context.Context) (int, error) {
+		if attempts.Add(1) == 1 {
+			<-ctx.Done()
+			close(canceled)
+			return 0, ctx.Err()
+		}
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("slow attempt is not canceled")
+	}
+}
+
+func TestPercentileDelay(t *testing.T) {
+	h := New("test", Config{Delay: time.Second, Percentile: 0.9}, zap.NewNop(), tally.NoopScope)
+	d, ok := h.delay()
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, d, "delay is used until enough latencies are observed")
+
+	for i := range latencyWindow + 100 {
+		h.observe(time.Duration(i%100+1) * time.Millisecond)
+	}
+	assert.Len(t, h.latencies, latencyWindow)
+	d, ok = h.delay()
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Millisecond, d)
+}
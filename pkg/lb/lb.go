@@ -0,0 +1,128 @@
+// Package lb provides client-side load-balancing policies.
+package lb
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"mmoviecom/pkg/errs"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy defines a load-balancing policy.
+type Policy string
+
+// Load-balancing policies. RoundRobin picks instances in turn,
+// LeastOutstanding picks the instance with the fewest requests in flight
+// and PowerOfTwo picks the less loaded of two random instances.
+const (
+	RoundRobin       Policy = "round_robin"
+	LeastOutstanding Policy = "least_outstanding"
+	PowerOfTwo       Policy = "power_of_two"
+)
+
+// ErrNoAddresses is returned when there are no addresses to pick from.
+var ErrNoAddresses = errs.Unavailable("no service addresses")
+
+// DefaultPolicy defines the policy of services without a configured one.
+const DefaultPolicy = RoundRobin
+
+// Policies lists all supported policies.
+var Policies = []Policy{RoundRobin, LeastOutstanding, PowerOfTwo}
+
+// Validate returns an error if the policy is not supported.
+func (p Policy) Validate() error {
+	for _, policy := range Policies {
+		if p == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported load-balancing policy: %s", p)
+}
+
+// Selector chooses one of several instances according to a policy.
+type Selector struct {
+	policy Policy
+	next   atomic.Uint64
+}
+
+// NewSelector creates a new selector. Unsupported policies fall back to DefaultPolicy.
+func NewSelector(policy Policy) *Selector {
+	if policy.Validate() != nil {
+		policy = DefaultPolicy
+	}
+	return &Selector{policy: policy}
+}
+
+// Choose returns the index of the chosen instance out of n,
+// given the number of outstanding requests of every instance.
+// n must be positive.
+func (s *Selector) Choose(n int, outstanding func(i int) int64) int {
+	if n <= 1 {
+		return 0
+	}
+	switch s.policy {
+	case LeastOutstanding:
+		// Start at a rotating offset so ties are spread across instances.
+		start := int(s.next.Add(1) % uint64(n))
+		best := start
+		for k := 1; k < n; k++ {
+			i := (start + k) % n
+			if outstanding(i) < outstanding(best) {
+				best = i
+			}
+		}
+		return best
+	case PowerOfTwo:
+		i := rand.IntN(n)
+		j := rand.IntN(n - 1)
+		if j >= i {
+			j++
+		}
+		if outstanding(j) < outstanding(i) {
+			return j
+		}
+		return i
+	default:
+		return int((s.next.Add(1) - 1) % uint64(n))
+	}
+}
+
+// Balancer picks service addresses according to a policy and tracks
+// the outstanding requests of every address.
+type Balancer struct {
+	sync.Mutex
+	selector    *Selector
+	outstanding map[string]*atomic.Int64
+}
+
+// New creates a new balancer of service addresses.
+func New(policy Policy) *Balancer {
+	return &Balancer{selector: NewSelector(policy), outstanding: map[string]*atomic.Int64{}}
+}
+
+// Pick returns the address to send a request to or ErrNoAddresses if there
+// are none. The returned done function must be called once the request completes.
+func (b *Balancer) Pick(addrs []string) (string, func(), error) {
+	if len(addrs) == 0 {
+		return "", nil, ErrNoAddresses
+	}
+	counters := make([]*atomic.Int64, len(addrs))
+	b.Lock()
+	for i, addr := range addrs {
+		c, ok := b.outstanding[addr]
+		if !ok {
+			c = &atomic.Int64{}
+			b.outstanding[addr] = c
+		}
+		counters[i] = c
+	}
+	b.Unlock()
+	i := b.selector.Choose(len(addrs), func(i int) int64 {
+		return counters[i].Load()
+	})
+	counters[i].Add(1)
+	return addrs[i], func() {
+		counters[i].Add(-1)
+	}, nil
+}
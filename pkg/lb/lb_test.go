@@ -0,0 +1,100 @@
+package lb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	for _, p := range Policies {
+		assert.NoError(t, p.Validate())
+	}
+	assert.Error(t, Policy("random").Validate())
+}
+
+func TestSelectorChoose(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      Policy
+		outstanding []int64
+		want        []int
+	}{
+		{
+			name:        "round robin",
+			policy:      RoundRobin,
+			outstanding: []int64{5, 0, 0},
+			want:        []int{0, 1, 2, 0},
+		},
+		{
+			name:        "unsupported policy falls back to round robin",
+			policy:      Policy("random"),
+			outstanding: []int64{0, 0},
+			want:        []int{0, 1, 0},
+		},
+		{
+			name:        "least outstanding",
+			policy:      LeastOutstanding,
+			outstanding: []int64{3, 1, 2},
+			want:        []int{1, 1, 1},
+		},
+		{
+			name:        "power of two with two instances",
+			policy:      PowerOfTwo,
+			outstanding: []int64{4, 2},
+			want:        []int{1, 1, 1},
+		},
+		{
+			name:        "single instance",
+			policy:      PowerOfTwo,
+			outstanding: []int64{7},
+			want:        []int{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSelector(tt.policy)
+			var got []int
+			for range tt.want {
+				got = append(got, s.Choose(len(tt.outstanding), func(i int) int64 { return tt.outstanding[i] }))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSelectorPowerOfTwo(t *testing.T) {
+	s := NewSelector(PowerOfTwo)
+	outstanding := []int64{0, 10, 10, 10}
+	for range 100 {
+		assert.NotEqual(t, 1, s.Choose(4, func(i int) int64 {
+			if i == 1 {
+				return 20
+			}
+			return outstanding[i]
+		}), "the most loaded instance always loses")
+	}
+}
+
+func TestBalancerPick(t *testing.T) {
+	b := New(LeastOutstanding)
+	addrs := []string{"a:1", "b:1"}
+	first, done, err := b.Pick(addrs)
+	assert.NoError(t, err)
+	second, _, err := b.Pick(addrs)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second, "busy address is avoided")
+	done()
+	third, _, err := b.Pick(addrs)
+	assert.NoError(t, err)
+	assert.Equal(t, first, third, "finished requests are no longer outstanding")
+}
+
+func TestBalancerPickNoAddresses(t *testing.T) {
+	for _, policy := range Policies {
+		t.Run(string(policy), func(t *testing.T) {
+			_, _, err := New(policy).Pick(nil)
+			assert.ErrorIs(t, err, ErrNoAddresses)
+		})
+	}
+}
@@ -3,12 +3,14 @@ package metrics
 import (
 	"fmt"
 	"io"
+	"mmoviecom/pkg/errs"
 	"net/http"
 	"time"
 
 	"github.com/uber-go/tally/v6"
 	"github.com/uber-go/tally/v6/prometheus"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 )
 
 func NewMetricsReporter(logger *zap.Logger, serviceName string, metricsPort int) (scope tally.Scope, closer io.Closer) {
@@ -37,6 +39,21 @@ type EndpointMetrics struct {
 	NotFoundErrors        tally.Counter
 	InternalErrors        tally.Counter
 	Successes             tally.Counter
+	errors                map[codes.Code]tally.Counter
+}
+
+// errorLabels defines the error tag values of the error status codes
+// counted separately. Errors with other codes are counted as internal.
+var errorLabels = map[codes.Code]string{
+	codes.InvalidArgument:  "invalid_argument",
+	codes.NotFound:         "not_found",
+	codes.Internal:         "internal",
+	codes.Unauthenticated:  "unauthenticated",
+	codes.PermissionDenied: "permission_denied",
+	codes.AlreadyExists:    "already_exists",
+	codes.Unavailable:      "unavailable",
+	codes.DeadlineExceeded: "deadline_exceeded",
+	codes.Canceled:         "canceled",
 }
 
 // NewEndpointMetrics creates a new endpoint metrics.
@@ -45,17 +62,28 @@ func NewEndpointMetrics(scope tally.Scope, endpoint string) *EndpointMetrics {
 		"component": "handler",
 		"endpoint":  endpoint,
 	})
+	counters := make(map[codes.Code]tally.Counter, len(errorLabels))
+	for code, label := range errorLabels {
+		counters[code] = scope.Tagged(map[string]string{
+			"error": label,
+		}).Counter("error")
+	}
 	return &EndpointMetrics{
-		Calls: scope.Counter("calls"),
-		InvalidArgumentErrors: scope.Tagged(map[string]string{
-			"error": "invalid_argument",
-		}).Counter("error"),
-		NotFoundErrors: scope.Tagged(map[string]string{
-			"error": "not_found",
-		}).Counter("error"),
-		InternalErrors: scope.Tagged(map[string]string{
-			"error": "internal",
-		}).Counter("error"),
-		Successes: scope.Counter("success"),
+		Calls:                 scope.Counter("calls"),
+		InvalidArgumentErrors: counters[codes.InvalidArgument],
+		NotFoundErrors:        counters[codes.NotFound],
+		InternalErrors:        counters[codes.Internal],
+		Successes:             scope.Counter("success"),
+		errors:                counters,
 	}
 }
+
+// IncError increments the error counter matching the status code of err,
+// so every domain error kind, deadline and cancellation is counted separately.
+func (m *EndpointMetrics) IncError(err error) {
+	counter, ok := m.errors[errs.GRPCCode(err)]
+	if !ok {
+		counter = m.InternalErrors
+	}
+	counter.Inc(1)
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mmoviecom/pkg/errs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+)
+
+func TestEndpointMetricsIncError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errs.NotFound("missing"), "not_found"},
+		{errs.InvalidArgument("bad"), "invalid_argument"},
+		{errs.Unauthenticated("no token"), "unauthenticated"},
+		{errs.PermissionDenied("denied"), "permission_denied"},
+		{errs.AlreadyExists("exists"), "already_exists"},
+		{errs.Unavailable("down"), "unavailable"},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), "deadline_exceeded"},
+		{context.Canceled, "canceled"},
+		{errors.New("failed"), "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			scope := tally.NewTestScope("", nil)
+			NewEndpointMetrics(scope, "test").IncError(tt.err)
+			counts := map[string]int64{}
+			for _, c := range scope.Snapshot().Counters() {
+				if c.Name() == "error" && c.Value() > 0 {
+					counts[c.Tags()["error"]] += c.Value()
+				}
+			}
+			assert.Equal(t, map[string]int64{tt.want: 1}, counts)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package retry provides retries of failed calls to other services with
+// exponential backoff and a retry budget.
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"mmoviecom/pkg/errs"
+	"mmoviecom/pkg/logging"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// budgetWindow defines how many seconds of minimum retries a budget accumulates.
+const budgetWindow = 10
+
+// Config defines a retry policy. A call is attempted up to MaxAttempts
+// times while it fails with one of RetryableCodes. Attempts are separated
+// by a backoff starting at InitialBackoff and growing by Multiplier up to
+// MaxBackoff, randomized by Jitter, a fraction of the backoff. A
+// MaxAttempts below 2 disables retries.
+type Config struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier" default:"2"`
+	Jitter         float64       `yaml:"jitter"`
+	RetryableCodes Codes         `yaml:"retryableCodes"`
+	Budget         BudgetConfig  `yaml:"budget"`
+}
+
+// BudgetConfig defines a retry budget. Every call earns Ratio retries and
+// MinRetriesPerSecond retries are allowed regardless of the call rate, so
+// retries cannot multiply the load of a failing service. A zero budget
+// does not limit retries.
+type BudgetConfig struct {
+	Ratio               float64 `yaml:"ratio"`
+	MinRetriesPerSecond float64 `yaml:"minRetriesPerSecond"`
+}
+
+// Codes defines a list of gRPC status codes, configured by their names
+// such as UNAVAILABLE.
+type Codes []codes.Code
+
+// UnmarshalYAML decodes a list of gRPC status code names.
+func (c *Codes) UnmarshalYAML(value *yaml.Node) error {
+	var names []string
+	if err := value.Decode(&names); err != nil {
+		return err
+	}
+	res := make(Codes, 0, len(names))
+	for _, name := range names {
+		var code codes.Code
+		b, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		if err := code.UnmarshalJSON(b); err != nil {
+			return fmt.Errorf("invalid retryable code %s: %w", name, err)
+		}
+		res = append(res, code)
+	}
+	*c = res
+	return nil
+}
+
+// Retrier defines a retrier of calls to a named dependency.
+type Retrier struct {
+	cfg             Config
+	budget          *budget
+	now             func() time.Time
+	logger          *zap.Logger
+	retries         tally.Counter
+	budgetExhausted tally.Counter
+}
+
+// New creates a new retrier of calls to a named dependency.
+func New(name string, cfg Config, logger *zap.Logger, scope tally.Scope) *Retrier {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "retrier"),
+		zap.String("retrier", name),
+	)
+	scope = scope.Tagged(map[string]string{
+		"component": "retrier",
+		"retrier":   name,
+	})
+	cfg.Multiplier = max(cfg.Multiplier, 1)
+	cfg.Jitter = min(max(cfg.Jitter, 0), 1)
+	r := &Retrier{
+		cfg:             cfg,
+		now:             time.Now,
+		logger:          logger,
+		retries:         scope.Counter("retries"),
+		budgetExhausted: scope.Counter("budget_exhausted"),
+	}
+	if cfg.Budget.Ratio > 0 || cfg.Budget.MinRetriesPerSecond > 0 {
+		r.budget = &budget{cfg: cfg.Budget, now: r.nowFunc}
+		r.budget.tokens = r.budget.capacity()
+	}
+	return r
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, runs out of attempts or the retry budget, or ctx is done.
+// The error of the last attempt is returned.
+func (r *Retrier) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.budget != nil {
+		r.budget.deposit()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= r.cfg.MaxAttempts || !r.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && r.now().Add(delay).After(deadline) {
+			return err
+		}
+		if r.budget != nil && !r.budget.withdraw() {
+			r.budgetExhausted.Inc(1)
+			r.logger.Debug("Retry budget exhausted", zap.Error(err))
+			return err
+		}
+		r.retries.Inc(1)
+		r.logger.Debug("Retrying failed call",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", delay),
+			zap.Error(err),
+		)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Retrier) retryable(err error) bool {
+	return slices.Contains(r.cfg.RetryableCodes, errs.GRPCCode(err))
+}
+
+// backoff returns the randomized wait after a failed attempt.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	d := float64(r.cfg.InitialBackoff) * math.Pow(r.cfg.Multiplier, float64(attempt-1))
+	if r.cfg.MaxBackoff > 0 {
+		d = min(d, float64(r.cfg.MaxBackoff))
+	}
+	d *= 1 + r.cfg.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+func (r *Retrier) nowFunc() time.Time {
+	return r.now()
+}
+
+// budget defines a token bucket of retries, which starts full. Calls
+// deposit Ratio tokens, MinRetriesPerSecond tokens are added every second
+// and every retry withdraws one token.
+type budget struct {
+	sync.Mutex
+	cfg    BudgetConfig
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func (b *budget) deposit() {
+	b.Lock()
+	defer b.Unlock()
+	b.refill()
+	b.tokens = min(b.tokens+b.cfg.Ratio, b.capacity())
+}
+
+func (b *budget) withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// capacity returns the maximum number of tokens, which bounds retry bursts.
+func (b *budget) capacity() float64 {
+	return max(budgetWindow, budgetWindow*b.cfg.MinRetriesPerSecond)
+}
+
+// refill adds the minimum retries of the time passed since the last
+// refill. Callers must hold the budget lock.
+func (b *budget) refill() {
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.cfg.MinRetriesPerSecond, b.capacity())
+	}
+	b.last = now
+}
@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"context"
+	"mmoviecom/pkg/errs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRetrierDo(t *testing.T) {
+	unavailable := errs.Unavailable("unavailable")
+	tests := []struct {
+		name         string
+		cfg          Config
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{
+			name:         "success",
+			cfg:          Config{MaxAttempts: 3, RetryableCodes: Codes{codes.Unavailable}},
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name:         "retryable error",
+			cfg:          Config{MaxAttempts: 3, RetryableCodes: Codes{codes.Unavailable}},
+			errs:         []error{unavailable, status.Error(codes.Unavailable, "unavailable"), nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "out of attempts",
+			cfg:          Config{MaxAttempts: 2, RetryableCodes: Codes{codes.Unavailable}},
+			errs:         []error{unavailable, unavailable, nil},
+			wantErr:      unavailable,
+			wantAttempts: 2,
+		},
+		{
+			name:         "code not retryable",
+			cfg:          Config{MaxAttempts: 3, RetryableCodes: Codes{codes.ResourceExhausted}},
+			errs:         []error{unavailable, nil},
+			wantErr:      unavailable,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries disabled",
+			cfg:          Config{RetryableCodes: Codes{codes.Unavailable}},
+			errs:         []error{unavailable, nil},
+			wantErr:      unavailable,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New("test", tt.cfg, zap.NewNop(), tally.NoopScope)
+			attempts := 0
+			err := r.Do(context.Background(), func(context.Context) error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
+
+func TestRetrierBackoff(t *testing.T) {
+	r := New("test", Config{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}, zap.NewNop(), tally.NoopScope)
+	assert.Equal(t, 100*time.Millisecond, r.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, r.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, r.backoff(4))
+	assert.Equal(t, time.Second, r.backoff(5), "backoff is capped")
+
+	r = New("test", Config{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}, zap.NewNop(), tally.NoopScope)
+	for range 100 {
+		d := r.backoff(3)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 150*time.Millisecond)
+	}
+}
+
+func TestRetrierContext(t *testing.T) {
+	r := New("test", Config{MaxAttempts: 3, InitialBackoff: time.Hour, RetryableCodes: Codes{codes.Unavailable}}, zap.NewNop(), tally.NoopScope)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := r.Do(ctx, func(context.Context) error {
+		attempts++
+		return errs.Unavailable("unavailable")
+	})
+	assert.ErrorIs(t, err, errs.ErrUnavailable)
+	assert.Equal(t, 1, attempts, "backoff wait ends with the context")
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	attempts = 0
+	assert.Error(t, r.Do(ctx, func(context.Context) error {
+		attempts++
+		return errs.Unavailable("unavailable")
+	}))
+	assert.Equal(t, 1, attempts, "no retry if the backoff exceeds the deadline")
+}
+
+func TestRetrierBudget(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := New("test", Config{
+		MaxAttempts:    2,
+		RetryableCodes: Codes{codes.Unavailable},
+		Budget:         BudgetConfig{Ratio: 0.5, MinRetriesPerSecond: 1},
+	}, zap.NewNop(), tally.NoopScope)
+	r.now = func() time.Time { return now }
+	attempts := 0
+	fail := func(context.Context) error {
+		attempts++
+		return errs.Unavailable("unavailable")
+	}
+	for range 40 {
+		assert.Error(t, r.Do(context.Background(), fail))
+	}
+	assert.LessOrEqual(t, attempts-40, 10+20, "retries are bounded by the initial tokens and the ratio")
+	attempts = 0
+	for range 4 {
+		assert.Error(t, r.Do(context.Background(), fail))
+	}
+	assert.Equal(t, 4+2, attempts, "exhausted budget allows Ratio retries per call")
+
+	now = now.Add(4 * time.Second)
+	attempts = 0
+	for range 4 {
+		assert.Error(t, r.Do(context.Background(), fail))
+	}
+	assert.Equal(t, 4+4, attempts, "minimum retries are replenished")
+}
+
+func TestCodesUnmarshalYAML(t *testing.T) {
+	var cfg Config
+	assert.NoError(t, yaml.Unmarshal([]byte("retryableCodes: [UNAVAILABLE, RESOURCE_EXHAUSTED]"), &cfg))
+	assert.Equal(t, Codes{codes.Unavailable, codes.ResourceExhausted}, cfg.RetryableCodes)
+	assert.Error(t, yaml.Unmarshal([]byte("retryableCodes: [BROKEN]"), &cfg))
+}
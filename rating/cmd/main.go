@@ -5,17 +5,21 @@ import (
 	"fmt"
 	"mmoviecom/gen"
 	"mmoviecom/internal/grpcutil"
+	"mmoviecom/pkg/breaker"
 	"mmoviecom/pkg/discovery"
 	"mmoviecom/pkg/discovery/consul"
 	"mmoviecom/pkg/limiter"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
+	"mmoviecom/pkg/retry"
 	"mmoviecom/pkg/tracing"
 	"mmoviecom/rating/configs"
 	"mmoviecom/rating/internal/controller/rating"
 	authgateway "mmoviecom/rating/internal/gateway/auth/grpc"
 	grpchandler "mmoviecom/rating/internal/handler/grpc"
 	"mmoviecom/rating/internal/ingester/kafka"
+	kafkapublisher "mmoviecom/rating/internal/publisher/kafka"
+	"mmoviecom/rating/internal/recordtype"
 	"mmoviecom/rating/internal/repository/mysql"
 	"net"
 	"os"
@@ -100,28 +104,52 @@ func main() {
 		}
 	}()
 
+	scope, closer := metrics.NewMetricsReporter(log, serviceName, cfg.Prometheus.MetricsPort)
+	defer func() {
+		if err := closer.Close(); err != nil {
+			log.Warn("Failed to close Prometheus reporter scope", zap.Error(err))
+		}
+	}()
+
 	repo, err := mysql.New(cfg.DatabaseConfig.Mysql, log)
 	if err != nil {
 		panic(err)
 	}
-	ingester, err := kafka.NewIngester(cfg.MessengerConfig.Kafka.Address, "rating", "ratings", log)
+	ingester, err := kafka.NewIngester(cfg.MessengerConfig.Kafka.Address, "rating", "ratings", log, scope)
 	if err != nil {
 		log.Fatal("Failed to initialize ingester")
 	}
 
-	creds := grpcutil.GetX509Credentials("cert.crt", "cert.key")
-	auth := authgateway.New(registry, creds, log)
-	svc := rating.New(repo, ingester, auth, log)
-	go func() {
-		if err := svc.StartIngestion(ctx); err != nil {
-			log.Fatal("Failed to start ingestion", zap.Error(err))
+	var publisher rating.Publisher
+	if cfg.PublisherConfig.Enabled {
+		p, err := kafkapublisher.NewPublisher(cfg.MessengerConfig.Kafka.Address, cfg.PublisherConfig.Topic, cfg.PublisherConfig.Debounce, log, scope)
+		if err != nil {
+			log.Fatal("Failed to initialize publisher", zap.Error(err))
 		}
-	}()
+		defer p.Close()
+		publisher = p
+	}
 
-	scope, closer := metrics.NewMetricsReporter(log, serviceName, cfg.Prometheus.MetricsPort)
+	recordTypes, err := recordtype.New(cfg.RecordTypes)
+	if err != nil {
+		log.Fatal("Failed to initialize record type registry", zap.Error(err))
+	}
+
+	creds := grpcutil.GetX509Credentials("cert.crt", "cert.key")
+	pool, err := grpcutil.NewConnPool(registry, creds, cfg.LoadBalancing)
+	if err != nil {
+		log.Fatal("Failed to create gRPC connection pool", zap.Error(err))
+	}
 	defer func() {
-		if err := closer.Close(); err != nil {
-			log.Warn("Failed to close Prometheus reporter scope", zap.Error(err))
+		if err := pool.Close(); err != nil {
+			log.Warn("Failed to close gRPC connections", zap.Error(err))
+		}
+	}()
+	auth := authgateway.New(pool, breaker.New("auth", cfg.CircuitBreaker, log, scope), retry.New("auth", cfg.Retry["auth"], log, scope), log)
+	svc := rating.New(repo, ingester, publisher, auth, recordTypes, cfg.AuthConfig.Admins, log, scope)
+	go func() {
+		if err := svc.StartIngestion(ctx, cfg.IngestionConfig.Workers, cfg.IngestionConfig.QueueSize); err != nil {
+			log.Fatal("Failed to start ingestion", zap.Error(err))
 		}
 	}()
 	h := grpchandler.New(svc, log, scope)
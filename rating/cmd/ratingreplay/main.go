@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mmoviecom/rating/configs"
+	"mmoviecom/rating/internal/replay"
+	"mmoviecom/rating/pkg/model"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	configFile := flag.String("config", "rating/configs/defaults.yaml", "Rating service configuration file")
+	kafkaAddr := flag.String("kafka", "localhost", "Kafka bootstrap servers")
+	topic := flag.String("topic", "ratings", "Rating events topic")
+	fromOffset := flag.Int64("from-offset", 0, "Offset to replay every partition from")
+	fromTime := flag.String("from-time", "", "Replay events produced since this RFC 3339 time instead of from-offset")
+	toTime := flag.String("to-time", "", "Skip events produced after this RFC 3339 time")
+	recordType := flag.String("record-type", "", "Replay only events of this record type")
+	recordIds := flag.String("record-ids", "", "Replay only events of these comma-separated record ids")
+	providers := flag.String("providers", "", "Replay only events of these comma-separated providers")
+	dryRun := flag.Bool("dry-run", true, "Apply events to an in-memory repository and only report the outcome")
+	flag.Parse()
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	replayCfg := replay.Config{
+		KafkaAddress: *kafkaAddr,
+		Topic:        *topic,
+		StartOffset:  *fromOffset,
+		RecordType:   model.RecordType(*recordType),
+		Providers:    splitList(*providers),
+		DryRun:       *dryRun,
+		Mysql:        cfg.DatabaseConfig.Mysql,
+		RecordTypes:  cfg.RecordTypes,
+		Ingestion:    cfg.IngestionConfig,
+	}
+	for _, id := range splitList(*recordIds) {
+		replayCfg.RecordIds = append(replayCfg.RecordIds, model.RecordId(id))
+	}
+	if replayCfg.StartTime, err = parseTime(*fromTime); err != nil {
+		panic(err)
+	}
+	if replayCfg.EndTime, err = parseTime(*toTime); err != nil {
+		panic(err)
+	}
+
+	logger, err := zap.NewProductionConfig().Build()
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if replayCfg.DryRun {
+		fmt.Println("Dry run, ratings are applied to an in-memory repository")
+	}
+	report, err := replay.Run(ctx, replayCfg, logger, tally.NoopScope)
+	if report != nil {
+		fmt.Print(report)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func readConfig(fileName string) (*configs.ServiceConfig, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg configs.ServiceConfig
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
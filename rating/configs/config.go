@@ -1,13 +1,26 @@
 package configs
 
+import (
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/lb"
+	"mmoviecom/pkg/retry"
+	"time"
+)
+
 type ServiceConfig struct {
-	API              apiConfig              `yaml:"api"`
-	ServiceDiscovery serviceDiscoveryConfig `yaml:"serviceDiscovery"`
-	MessengerConfig  MessengerConfig        `yaml:"messenger"`
-	DatabaseConfig   DatabaseConfig         `yaml:"database"`
-	AuthConfig       AuthConfig             `yaml:"auth"`
-	Jaeger           jaegerConfig           `yaml:"jaeger"`
-	Prometheus       prometheusConfig       `yaml:"prometheus"`
+	API              apiConfig               `yaml:"api"`
+	ServiceDiscovery serviceDiscoveryConfig  `yaml:"serviceDiscovery"`
+	MessengerConfig  MessengerConfig         `yaml:"messenger"`
+	IngestionConfig  IngestionConfig         `yaml:"ingestion"`
+	PublisherConfig  PublisherConfig         `yaml:"publisher"`
+	RecordTypes      []RecordTypeConfig      `yaml:"recordTypes"`
+	DatabaseConfig   DatabaseConfig          `yaml:"database"`
+	AuthConfig       AuthConfig              `yaml:"auth"`
+	CircuitBreaker   breaker.Config          `yaml:"circuitBreaker"`
+	LoadBalancing    map[string]lb.Policy    `yaml:"loadBalancing"`
+	Retry            map[string]retry.Config `yaml:"retry"`
+	Jaeger           jaegerConfig            `yaml:"jaeger"`
+	Prometheus       prometheusConfig        `yaml:"prometheus"`
 }
 
 type apiConfig struct {
@@ -30,6 +43,24 @@ type kafkaConfig struct {
 	Port    int    `yaml:"port" default:"9092"`
 }
 
+type IngestionConfig struct {
+	Workers   int `yaml:"workers" default:"1"`
+	QueueSize int `yaml:"queueSize" default:"1"`
+}
+
+type PublisherConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Topic    string        `yaml:"topic" default:"rating-changes"`
+	Debounce time.Duration `yaml:"debounce"`
+}
+
+type RecordTypeConfig struct {
+	Name      string `yaml:"name"`
+	MinValue  int    `yaml:"minValue" default:"1"`
+	MaxValue  int    `yaml:"maxValue" default:"5"`
+	IdPattern string `yaml:"idPattern"`
+}
+
 type DatabaseConfig struct {
 	Mysql MysqlConfig `yaml:"mysql"`
 }
@@ -43,8 +74,9 @@ type MysqlConfig struct {
 }
 
 type AuthConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port" default:"8084"`
+	Host   string   `yaml:"host"`
+	Port   int      `yaml:"port" default:"8084"`
+	Admins []string `yaml:"admins"`
 }
 
 type jaegerConfig struct {
@@ -4,73 +4,413 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/rating/internal/recordtype"
 	"mmoviecom/rating/internal/repository"
 	"mmoviecom/rating/pkg/model"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
 )
 
 // ErrNotFound returned when no ratings are found for a record.
-var ErrNotFound = errors.New("rating not found for a record")
-var ErrTokenIsEmpty = errors.New("token is empty")
+var ErrNotFound = errs.NotFound("rating not found for a record")
+
+// ErrTokenIsEmpty is returned when a request has no token.
+var ErrTokenIsEmpty = errs.Unauthenticated("token is empty")
+
+// ErrIncorrectToken is returned when a token does not belong to the rating user.
+var ErrIncorrectToken = errs.Unauthenticated("incorrect token")
+
+// ErrUnsupportedRecordType is returned when a record type is not in the record type registry.
+var ErrUnsupportedRecordType = errs.InvalidArgument("unsupported record type")
+
+// ErrInvalidRating is returned when a rating does not pass validation.
+var ErrInvalidRating = errs.InvalidArgument("invalid rating")
+
+// ErrReviewNotFound is returned when a user has no review for a record.
+var ErrReviewNotFound = errs.NotFound("review not found")
+
+// ErrInvalidReviewStatus is returned when a review moderation status is unknown.
+var ErrInvalidReviewStatus = errs.InvalidArgument("invalid review status")
+
+// ErrPermissionDenied is returned when a user is not allowed to perform an action.
+var ErrPermissionDenied = errs.PermissionDenied("permission denied")
+
+// ErrInvalidWindow is returned when a time window is negative.
+var ErrInvalidWindow = errs.InvalidArgument("invalid time window")
+
+// ErrTooManyRecords is returned when a bulk request exceeds MaxBulkRecords.
+var ErrTooManyRecords = errs.InvalidArgument("too many records")
+
+// MaxBulkRecords defines the maximum number of records of a bulk request.
+const MaxBulkRecords = 100
+
+// Trending defaults.
+const (
+	DefaultTrendingWindow = 7 * 24 * time.Hour
+	DefaultTrendingLimit  = 10
+	MaxTrendingLimit      = 100
+)
+
+// Page size limits of paginated lists.
+const (
+	DefaultTopRatedPageSize = 20
+	MaxTopRatedPageSize     = 100
+	DefaultReviewsPageSize  = 20
+	MaxReviewsPageSize      = 100
+)
 
 var validate = validator.New()
 
 type ratingRepository interface {
-	Get(ctx context.Context, recordId model.RecordId, recordType model.RecordType) ([]model.Rating, error)
 	Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, record *model.Rating) error
+	Aggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType, since time.Time, providers []string) (*model.AggregatedRating, error)
+	ListTrending(ctx context.Context, recordType model.RecordType, since time.Time, limit int) ([]model.RecordAggregate, error)
+	ListTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, limit int) ([]model.RecordAggregate, error)
+	ListAggregates(ctx context.Context, recordType model.RecordType, recordIds []model.RecordId) ([]model.RecordAggregate, error)
+	ListReviews(ctx context.Context, recordId model.RecordId, recordType model.RecordType, status model.ReviewStatus, offset int, limit int) ([]model.Rating, error)
+	SetReviewStatus(ctx context.Context, recordId model.RecordId, recordType model.RecordType, userId model.UserId, status model.ReviewStatus) error
 }
 
 type ratingIngester interface {
 	Ingest(ctx context.Context) (chan model.RatingEvent, error)
 }
 
+// Publisher defines a publisher of aggregated rating changes.
+type Publisher interface {
+	Publish(ctx context.Context, event *model.AggregatedRatingChangedEvent) error
+}
+
 type AuthGateway interface {
 	ValidateToken(ctx context.Context, token string) (string, error)
 }
 
 // Controller defines a rating service controller.
 type Controller struct {
-	repo     ratingRepository
-	ingester ratingIngester
-	auth     AuthGateway
-	logger   *zap.Logger
+	repo             ratingRepository
+	ingester         ratingIngester
+	publisher        Publisher
+	auth             AuthGateway
+	recordTypes      *recordtype.Registry
+	admins           map[model.UserId]bool
+	hub              *hub
+	logger           *zap.Logger
+	ingestionMetrics *ingestionMetrics
+}
+
+// ingestionMetrics defines rating event ingestion metrics.
+type ingestionMetrics struct {
+	processed tally.Counter
+	errors    tally.Counter
+	latency   tally.Timer
 }
 
-// New creates a rating service controller.
-func New(repo ratingRepository, ingester ratingIngester, auth AuthGateway, logger *zap.Logger) *Controller {
+// New creates a rating service controller. The publisher is optional,
+// aggregated rating changes are not published if it is nil.
+func New(repo ratingRepository, ingester ratingIngester, publisher Publisher, auth AuthGateway, recordTypes *recordtype.Registry, admins []string, logger *zap.Logger, scope tally.Scope) *Controller {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "controller"),
 	)
-	return &Controller{repo: repo, ingester: ingester, auth: auth, logger: logger}
+	adminSet := map[model.UserId]bool{}
+	for _, a := range admins {
+		adminSet[model.UserId(a)] = true
+	}
+	scope = scope.Tagged(map[string]string{
+		"component": "ingestion",
+	})
+	return &Controller{
+		repo:        repo,
+		ingester:    ingester,
+		publisher:   publisher,
+		auth:        auth,
+		recordTypes: recordTypes,
+		admins:      adminSet,
+		hub:         newHub(),
+		logger:      logger,
+		ingestionMetrics: &ingestionMetrics{
+			processed: scope.Counter("events_processed"),
+			errors:    scope.Counter("events_failed"),
+			latency:   scope.Timer("event_latency"),
+		},
+	}
 }
 
 // GetAggregatedRating returns the aggregated rating for a
-// record or ErrNotFound if there are no ratings for it.
-func (c *Controller) GetAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType) (float64, error) {
-	ratings, err := c.repo.Get(ctx, recordId, recordType)
+// record or ErrNotFound if there are no ratings for it. If window
+// is positive, only ratings updated within the window are aggregated.
+// If providers are given, only ratings of these providers are aggregated.
+func (c *Controller) GetAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, window time.Duration, providers []string) (*model.AggregatedRating, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if window < 0 {
+		return nil, ErrInvalidWindow
+	}
+	return c.aggregate(ctx, recordId, recordType, window, providers)
+}
+
+// GetAggregatedRatings returns the aggregated ratings of records of a given type
+// in a single request. Records without ratings are omitted.
+func (c *Controller) GetAggregatedRatings(ctx context.Context, recordIds []model.RecordId, recordType model.RecordType) ([]model.RecordAggregate, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if len(recordIds) > MaxBulkRecords {
+		return nil, ErrTooManyRecords
+	}
+	if len(recordIds) == 0 {
+		return nil, nil
+	}
+	return c.repo.ListAggregates(ctx, recordType, recordIds)
+}
+
+// aggregate returns the mean, the number of ratings and the number of
+// ratings of every provider for a record or ErrNotFound if there are no
+// ratings for it.
+func (c *Controller) aggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType, window time.Duration, providers []string) (*model.AggregatedRating, error) {
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	res, err := c.repo.Aggregate(ctx, recordId, recordType, since, providers)
 	if err != nil && errors.Is(err, repository.ErrNotFound) {
-		return 0, ErrNotFound
-	} else if err != nil {
-		return 0, err
-	} else if len(ratings) == 0 {
-		return 0, ErrNotFound
+		return nil, ErrNotFound
+	}
+	return res, err
+}
+
+// currentAggregate returns the aggregated rating of a record kept up to date
+// by the repository on every write, or ErrNotFound if there are no ratings for it.
+func (c *Controller) currentAggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType) (*model.RecordAggregate, error) {
+	aggs, err := c.repo.ListAggregates(ctx, recordType, []model.RecordId{recordId})
+	if err != nil {
+		return nil, err
+	}
+	if len(aggs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &aggs[0], nil
+}
+
+// GetTrending returns records of a given type ranked by rating velocity,
+// the number of ratings per hour updated within the window.
+func (c *Controller) GetTrending(ctx context.Context, recordType model.RecordType, window time.Duration, limit int) ([]model.TrendingRecord, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if window < 0 {
+		return nil, ErrInvalidWindow
+	} else if window == 0 {
+		window = DefaultTrendingWindow
+	}
+	if limit <= 0 {
+		limit = DefaultTrendingLimit
+	}
+	limit = min(limit, MaxTrendingLimit)
+	aggs, err := c.repo.ListTrending(ctx, recordType, time.Now().Add(-window), limit)
+	if err != nil {
+		return nil, err
 	}
-	sum := float64(0)
-	for _, r := range ratings {
-		sum += float64(r.Value)
+	res := make([]model.TrendingRecord, 0, len(aggs))
+	for _, agg := range aggs {
+		res = append(res, model.TrendingRecord{
+			RecordId: agg.RecordId,
+			Velocity: float64(agg.Count) / window.Hours(),
+			Rating:   agg.Rating,
+			Count:    agg.Count,
+		})
 	}
-	return sum / float64(len(ratings)), nil
+	return res, nil
 }
 
-// PutRating writes a rating for a given record.
+// GetTopRated returns a page of records of a given type with at least minVotes
+// ratings, ordered by aggregated rating, and the offset of the next page or 0
+// if there are no more records.
+func (c *Controller) GetTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, pageSize int) ([]model.RecordAggregate, int, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultTopRatedPageSize
+	}
+	pageSize = min(pageSize, MaxTopRatedPageSize)
+	res, err := c.repo.ListTopRated(ctx, recordType, max(minVotes, 0), max(offset, 0), pageSize+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(res) <= pageSize {
+		return res, 0, nil
+	}
+	return res[:pageSize], max(offset, 0) + pageSize, nil
+}
+
+// PutRating writes a rating for a given record. A review is pending moderation
+// until it is approved, a rating without a review keeps the existing review.
+// Ratings without an update time, such as user ratings, are updated now,
+// ingested ratings keep the time of their events. A rating older than the
+// stored rating of the user, such as a replayed event, is ignored.
 func (c *Controller) PutRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType, record *model.Rating) error {
+	if err := c.ValidateRating(recordId, recordType, record); err != nil {
+		return err
+	}
+	if record.Review != "" {
+		record.ReviewStatus = model.ReviewStatusPending
+	} else {
+		record.ReviewStatus = ""
+	}
+	if record.UpdatedAt.IsZero() {
+		record.UpdatedAt = time.Now()
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = record.UpdatedAt
+	}
+	err := c.repo.Put(ctx, recordId, recordType, record)
+	if err != nil && errors.Is(err, repository.ErrOutdated) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	c.notifyAggregatedRating(ctx, recordId, recordType)
+	return nil
+}
+
+// ListReviews returns a page of approved reviews of a record, most recently
+// updated first, and the offset of the next page or 0 if there are no more reviews.
+func (c *Controller) ListReviews(ctx context.Context, recordId model.RecordId, recordType model.RecordType, offset int, pageSize int) ([]model.Rating, int, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultReviewsPageSize
+	}
+	pageSize = min(pageSize, MaxReviewsPageSize)
+	res, err := c.repo.ListReviews(ctx, recordId, recordType, model.ReviewStatusApproved, max(offset, 0), pageSize+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(res) <= pageSize {
+		return res, 0, nil
+	}
+	return res[:pageSize], max(offset, 0) + pageSize, nil
+}
+
+// ModerateReview sets the moderation status of a user review of a record.
+func (c *Controller) ModerateReview(ctx context.Context, recordId model.RecordId, recordType model.RecordType, userId model.UserId, status model.ReviewStatus) error {
+	switch status {
+	case model.ReviewStatusPending, model.ReviewStatusApproved, model.ReviewStatusRejected:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidReviewStatus, status)
+	}
+	err := c.repo.SetReviewStatus(ctx, recordId, recordType, userId, status)
+	if err != nil && errors.Is(err, repository.ErrNotFound) {
+		return ErrReviewNotFound
+	}
+	return err
+}
+
+// ValidateAdminToken validates token and checks that its user is an admin.
+func (c *Controller) ValidateAdminToken(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrTokenIsEmpty
+	}
+	user, err := c.auth.ValidateToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !c.admins[model.UserId(user)] {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// ValidateRating checks a rating against the rules of its record type.
+func (c *Controller) ValidateRating(recordId model.RecordId, recordType model.RecordType, record *model.Rating) error {
 	if err := validate.Struct(record); err != nil {
-		return fmt.Errorf("rating validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidRating, err)
+	}
+	rules, ok := c.recordTypes.Get(recordType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	if err := rules.Validate(recordId, record.Value); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRating, err)
 	}
-	return c.repo.Put(ctx, recordId, recordType, record)
+	return nil
+}
+
+// notifyAggregatedRating sends the current aggregated rating of a record to its
+// watchers and the publisher. Notifications of a record are serialized, so
+// concurrent writes never publish an older aggregate after a newer one.
+// Failures are logged and do not affect the rating write.
+func (c *Controller) notifyAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType) {
+	if c.publisher == nil && !c.hub.watched(recordId, recordType) {
+		return
+	}
+	unlock := c.hub.lockRecord(recordId, recordType)
+	defer unlock()
+	watched := c.hub.watched(recordId, recordType)
+	agg, err := c.currentAggregate(ctx, recordId, recordType)
+	if err != nil {
+		c.logger.Warn("Failed to aggregate rating for publishing", zap.String("recordId", string(recordId)), zap.Error(err))
+		return
+	}
+	event := model.AggregatedRatingChangedEvent{
+		SchemaVersion: model.RatingEventSchemaVersion,
+		RecordId:      recordId,
+		RecordType:    recordType,
+		Rating:        agg.Rating,
+		Count:         agg.Count,
+	}
+	if watched {
+		c.hub.broadcast(event)
+	}
+	if c.publisher == nil {
+		return
+	}
+	if err := c.publisher.Publish(ctx, &event); err != nil {
+		c.logger.Warn("Failed to publish aggregated rating", zap.String("recordId", string(recordId)), zap.Error(err))
+	}
+}
+
+// WatchAggregatedRating returns a channel receiving the aggregated rating of
+// a record, first the current one if the record has ratings, then every change.
+// A slow receiver only gets the latest change. The channel is closed once
+// ctx is done.
+func (c *Controller) WatchAggregatedRating(ctx context.Context, recordId model.RecordId, recordType model.RecordType) (<-chan model.AggregatedRatingChangedEvent, error) {
+	if _, ok := c.recordTypes.Get(recordType); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecordType, recordType)
+	}
+	// Subscribe first, so no change is missed while the current
+	// aggregate is read.
+	w := c.hub.subscribe(recordId, recordType)
+	unlock := c.hub.lockRecord(recordId, recordType)
+	agg, err := c.currentAggregate(ctx, recordId, recordType)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		unlock()
+		c.hub.unsubscribe(w)
+		return nil, err
+	}
+	if err == nil {
+		c.hub.offerInitial(w, model.AggregatedRatingChangedEvent{
+			SchemaVersion: model.RatingEventSchemaVersion,
+			RecordId:      recordId,
+			RecordType:    recordType,
+			Rating:        agg.Rating,
+			Count:         agg.Count,
+		})
+	}
+	unlock()
+	go func() {
+		<-ctx.Done()
+		c.hub.unsubscribe(w)
+	}()
+	return w.ch, nil
 }
 
 // ValidateToken validates token, get user id from token and compares with record one.
@@ -83,25 +423,102 @@ func (c *Controller) ValidateToken(ctx context.Context, token string, record *mo
 		return err
 	}
 	if user == "" || user != string(record.UserId) {
-		return errors.New("incorrect token")
+		return ErrIncorrectToken
 	}
 	return nil
 }
 
-// StartIngestion starts the ingestion of rating events.
-func (c *Controller) StartIngestion(ctx context.Context) error {
+// StartIngestion starts the ingestion of rating events. Events are processed
+// concurrently by a pool of workers, each with a queue of queueSize events.
+// Events with the same record and user are always routed to the same worker
+// to preserve their order.
+func (c *Controller) StartIngestion(ctx context.Context, workers int, queueSize int) error {
 	ch, err := c.ingester.Ingest(ctx)
 	if err != nil {
 		return err
 	}
-	for e := range ch {
-		c.logger.Debug("Consume a message", zap.Stringer("message", &e))
-		if err := c.PutRating(ctx, model.RecordId(e.RecordId), model.RecordType(e.RecordType), &model.Rating{
-			UserId: e.UserId,
-			Value:  e.Value,
-		}); err != nil {
-			return err
+	workers = max(workers, 1)
+	queueSize = max(queueSize, 1)
+	c.logger.Info("Starting ingestion workers", zap.Int("workers", workers), zap.Int("queueSize", queueSize))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, workers)
+	queues := make([]chan model.RatingEvent, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan model.RatingEvent, queueSize)
+		wg.Add(1)
+		go func(queue chan model.RatingEvent) {
+			defer wg.Done()
+			for e := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := c.ingestEvent(ctx, &e); err != nil {
+					if ctx.Err() == nil {
+						errCh <- err
+						cancel()
+					}
+					return
+				}
+			}
+		}(queues[i])
+	}
+
+dispatch:
+	for {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case e, ok := <-ch:
+			if !ok {
+				break dispatch
+			}
+			select {
+			case queues[workerIndex(&e, workers)] <- e:
+			case <-ctx.Done():
+				break dispatch
+			}
 		}
 	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return nil
+	}
+}
+
+// ingestEvent applies a single rating event.
+func (c *Controller) ingestEvent(ctx context.Context, e *model.RatingEvent) error {
+	c.logger.Debug("Consume a message", zap.Stringer("message", e))
+	start := time.Now()
+	rating := e.Rating
+	err := c.PutRating(ctx, model.RecordId(e.RecordId), model.RecordType(e.RecordType), &rating)
+	c.ingestionMetrics.latency.Record(time.Since(start))
+	if err != nil && (errors.Is(err, ErrInvalidRating) || errors.Is(err, ErrUnsupportedRecordType)) {
+		c.ingestionMetrics.errors.Inc(1)
+		c.logger.Warn("Skipping invalid rating event", zap.Stringer("message", e), zap.Error(err))
+		return nil
+	} else if err != nil {
+		c.ingestionMetrics.errors.Inc(1)
+		return err
+	}
+	c.ingestionMetrics.processed.Inc(1)
 	return nil
 }
+
+// workerIndex returns the index of a worker responsible for the event
+// record and user pair.
+func workerIndex(e *model.RatingEvent, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(e.RecordId))
+	h.Write([]byte{0})
+	h.Write([]byte(e.UserId))
+	return int(h.Sum32() % uint32(workers))
+}
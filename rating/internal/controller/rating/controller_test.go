@@ -0,0 +1,457 @@
+package rating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mmoviecom/rating/internal/recordtype"
+	"mmoviecom/rating/internal/repository/memory"
+	"mmoviecom/rating/pkg/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+type testIngester struct {
+	events []model.RatingEvent
+}
+
+func (i *testIngester) Ingest(_ context.Context) (chan model.RatingEvent, error) {
+	ch := make(chan model.RatingEvent, len(i.events))
+	for _, e := range i.events {
+		ch <- e
+	}
+	close(ch)
+	return ch, nil
+}
+
+// orderRecorder records the rating values put to a repository
+// in order for every record and user pair.
+type orderRecorder struct {
+	*memory.Repository
+	mu   sync.Mutex
+	puts map[string][]model.RatingValue
+}
+
+func (r *orderRecorder) Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating) error {
+	r.mu.Lock()
+	key := string(recordId) + "/" + string(rating.UserId)
+	r.puts[key] = append(r.puts[key], rating.Value)
+	r.mu.Unlock()
+	return r.Repository.Put(ctx, recordId, recordType, rating)
+}
+
+func TestControllerStartIngestion(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{
+			name:    "single worker",
+			workers: 1,
+		},
+		{
+			name:    "worker pool",
+			workers: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zap.NewNop()
+			ingester := &testIngester{}
+			for i := 0; i < 100; i++ {
+				ingester.events = append(ingester.events, model.RatingEvent{
+					Rating: model.Rating{
+						RecordId:   fmt.Sprintf("record%d", i%5),
+						RecordType: string(model.RecordTypeMovie),
+						UserId:     model.UserId(fmt.Sprintf("user%d", i%3)),
+						Value:      model.RatingValue(i/15%5 + 1),
+						ProviderId: "test",
+					},
+					EventType: model.RatingEventTypePut,
+				})
+			}
+			repo := &orderRecorder{Repository: memory.New(logger), puts: map[string][]model.RatingValue{}}
+			c := New(repo, ingester, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+			ctx := context.Background()
+			err := c.StartIngestion(ctx, tt.workers, 2)
+			assert.NoError(t, err, tt.name)
+
+			// Events of each record and user pair must be applied in order.
+			want := map[string][]model.RatingValue{}
+			for _, e := range ingester.events {
+				key := e.RecordId + "/" + string(e.UserId)
+				want[key] = append(want[key], e.Value)
+			}
+			assert.Equal(t, want, repo.puts, tt.name)
+
+			// The last event of each record and user pair must win.
+			for r := 0; r < 5; r++ {
+				recordId := model.RecordId(fmt.Sprintf("record%d", r))
+				ratings, err := repo.Get(ctx, recordId, model.RecordTypeMovie)
+				assert.NoError(t, err, tt.name)
+				for _, rating := range ratings {
+					values := want[string(recordId)+"/"+string(rating.UserId)]
+					assert.Equal(t, values[len(values)-1], rating.Value, tt.name)
+				}
+			}
+		})
+	}
+}
+
+type testPublisher struct {
+	events []model.AggregatedRatingChangedEvent
+}
+
+func (p *testPublisher) Publish(_ context.Context, event *model.AggregatedRatingChangedEvent) error {
+	p.events = append(p.events, *event)
+	return nil
+}
+
+// aggregateOnlyRepository defines a repository failing to aggregate ratings
+// of a record, so only the running aggregates can be used.
+type aggregateOnlyRepository struct {
+	*memory.Repository
+}
+
+func (r *aggregateOnlyRepository) Aggregate(_ context.Context, _ model.RecordId, _ model.RecordType, _ time.Time, _ []string) (*model.AggregatedRating, error) {
+	return nil, errors.New("ratings must not be aggregated")
+}
+
+func TestControllerPutRatingPublishes(t *testing.T) {
+	logger := zap.NewNop()
+	publisher := &testPublisher{}
+	c := New(&aggregateOnlyRepository{memory.New(logger)}, nil, publisher, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	for i, v := range []model.RatingValue{5, 2} {
+		err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "id",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+			Value:      v,
+			ProviderId: model.NativeProviderId,
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []model.AggregatedRatingChangedEvent{
+		{SchemaVersion: model.RatingEventSchemaVersion, RecordId: "id", RecordType: model.RecordTypeMovie, Rating: 5, Count: 1},
+		{SchemaVersion: model.RatingEventSchemaVersion, RecordId: "id", RecordType: model.RecordTypeMovie, Rating: 3.5, Count: 2},
+	}, publisher.events)
+}
+
+func TestControllerGetTrending(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	votes := map[string][]model.RatingValue{
+		"cold": {5},
+		"hot":  {3, 4, 5},
+		"warm": {2, 4},
+	}
+	for recordId, values := range votes {
+		for i, v := range values {
+			err := c.PutRating(ctx, model.RecordId(recordId), model.RecordTypeMovie, &model.Rating{
+				RecordId:   recordId,
+				RecordType: string(model.RecordTypeMovie),
+				UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+				Value:      v,
+				ProviderId: model.NativeProviderId,
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	res, err := c.GetTrending(ctx, model.RecordTypeMovie, time.Hour, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.TrendingRecord{
+		{RecordId: "hot", Velocity: 3, Rating: 4, Count: 3},
+		{RecordId: "warm", Velocity: 2, Rating: 3, Count: 2},
+	}, res)
+
+	_, err = c.GetTrending(ctx, model.RecordTypeSeries, time.Hour, 2)
+	assert.ErrorIs(t, err, ErrUnsupportedRecordType)
+}
+
+func TestControllerPutRatingKeepsEventTime(t *testing.T) {
+	logger := zap.NewNop()
+	repo := memory.New(logger)
+	c := New(repo, nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	eventTime := time.Now().Add(-48 * time.Hour).UTC()
+	err := c.PutRating(ctx, "1", model.RecordTypeMovie, &model.Rating{
+		RecordId:   "1",
+		RecordType: string(model.RecordTypeMovie),
+		UserId:     "user",
+		Value:      5,
+		ProviderId: model.NativeProviderId,
+		UpdatedAt:  eventTime,
+	})
+	assert.NoError(t, err)
+
+	ratings, err := repo.Get(ctx, "1", model.RecordTypeMovie)
+	assert.NoError(t, err)
+	if assert.Len(t, ratings, 1) {
+		assert.True(t, ratings[0].UpdatedAt.Equal(eventTime))
+		assert.True(t, ratings[0].CreatedAt.Equal(eventTime))
+	}
+
+	res, err := c.GetTrending(ctx, model.RecordTypeMovie, time.Hour, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, res, "old events are outside the trending window")
+}
+
+func TestControllerGetTopRated(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	votes := map[string][]model.RatingValue{
+		"a": {5},
+		"b": {4, 5},
+		"c": {3, 3},
+		"d": {5, 5, 4},
+	}
+	for recordId, values := range votes {
+		for i, v := range values {
+			err := c.PutRating(ctx, model.RecordId(recordId), model.RecordTypeMovie, &model.Rating{
+				RecordId:   recordId,
+				RecordType: string(model.RecordTypeMovie),
+				UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+				Value:      v,
+				ProviderId: model.NativeProviderId,
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	page, next, err := c.GetTopRated(ctx, model.RecordTypeMovie, 2, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RecordAggregate{
+		{RecordId: "d", Rating: 14.0 / 3, Count: 3},
+		{RecordId: "b", Rating: 4.5, Count: 2},
+	}, page)
+	assert.Equal(t, 2, next)
+
+	page, next, err = c.GetTopRated(ctx, model.RecordTypeMovie, 2, next, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RecordAggregate{
+		{RecordId: "c", Rating: 3, Count: 2},
+	}, page)
+	assert.Equal(t, 0, next)
+}
+
+func TestControllerReviews(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	for i, review := range []string{"great", "awful", ""} {
+		err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "id",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+			Value:      5,
+			ProviderId: model.NativeProviderId,
+			Review:     review,
+		})
+		assert.NoError(t, err)
+	}
+
+	reviews, _, err := c.ListReviews(ctx, "id", model.RecordTypeMovie, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, reviews, "pending reviews must not be listed")
+
+	assert.NoError(t, c.ModerateReview(ctx, "id", model.RecordTypeMovie, "user0", model.ReviewStatusApproved))
+	assert.NoError(t, c.ModerateReview(ctx, "id", model.RecordTypeMovie, "user1", model.ReviewStatusRejected))
+	assert.ErrorIs(t, c.ModerateReview(ctx, "id", model.RecordTypeMovie, "user2", model.ReviewStatusApproved), ErrReviewNotFound)
+	assert.ErrorIs(t, c.ModerateReview(ctx, "id", model.RecordTypeMovie, "user0", "unknown"), ErrInvalidReviewStatus)
+
+	reviews, next, err := c.ListReviews(ctx, "id", model.RecordTypeMovie, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, next)
+	if assert.Len(t, reviews, 1) {
+		assert.Equal(t, model.UserId("user0"), reviews[0].UserId)
+		assert.Equal(t, "great", reviews[0].Review)
+	}
+
+	// A rating without a review, like an ingested rating event, keeps the review.
+	err = c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+		RecordId:   "id",
+		RecordType: string(model.RecordTypeMovie),
+		UserId:     "user0",
+		Value:      4,
+		ProviderId: model.NativeProviderId,
+	})
+	assert.NoError(t, err)
+	reviews, _, err = c.ListReviews(ctx, "id", model.RecordTypeMovie, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, reviews, 1) {
+		assert.Equal(t, "great", reviews[0].Review)
+		assert.Equal(t, model.ReviewStatusApproved, reviews[0].ReviewStatus)
+		assert.Equal(t, model.RatingValue(4), reviews[0].Value)
+	}
+}
+
+func TestControllerWatchAggregatedRating(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	put := func(userId model.UserId, v model.RatingValue) {
+		err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "id",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     userId,
+			Value:      v,
+			ProviderId: model.NativeProviderId,
+		})
+		assert.NoError(t, err)
+	}
+	put("user0", 5)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	events, err := c.WatchAggregatedRating(watchCtx, "id", model.RecordTypeMovie)
+	assert.NoError(t, err)
+	e := <-events
+	assert.Equal(t, 5.0, e.Rating)
+	assert.Equal(t, 1, e.Count)
+
+	put("user1", 2)
+	e = <-events
+	assert.Equal(t, 3.5, e.Rating)
+	assert.Equal(t, 2, e.Count)
+
+	cancel()
+	for range events {
+	}
+	assert.False(t, c.hub.watched("id", model.RecordTypeMovie))
+
+	_, err = c.WatchAggregatedRating(ctx, "id", model.RecordTypeSeries)
+	assert.ErrorIs(t, err, ErrUnsupportedRecordType)
+}
+
+func TestControllerWatchAggregatedRatingConcurrentWrites(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const writes = 50
+	var wg sync.WaitGroup
+	put := func(i int) {
+		defer wg.Done()
+		err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "id",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+			Value:      5,
+			ProviderId: model.NativeProviderId,
+		})
+		assert.NoError(t, err)
+	}
+	wg.Add(writes / 2)
+	for i := range writes / 2 {
+		go put(i)
+	}
+	events, err := c.WatchAggregatedRating(ctx, "id", model.RecordTypeMovie)
+	assert.NoError(t, err)
+	wg.Add(writes - writes/2)
+	for i := writes / 2; i < writes; i++ {
+		go put(i)
+	}
+
+	// Every user adds a rating, so counts never decrease.
+	count := 0
+	timeout := time.After(5 * time.Second)
+	for count < writes {
+		select {
+		case e := <-events:
+			assert.GreaterOrEqual(t, e.Count, count, "an older aggregate follows a newer one")
+			count = e.Count
+		case <-timeout:
+			t.Fatalf("the latest aggregate was not received, last count %d", count)
+		}
+	}
+	wg.Wait()
+}
+
+func TestControllerGetAggregatedRatingProviders(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	for i, provider := range []string{model.NativeProviderId, "partner", "partner"} {
+		err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "id",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+			Value:      model.RatingValue(i + 1),
+			ProviderId: provider,
+		})
+		assert.NoError(t, err)
+	}
+
+	err := c.PutRating(ctx, "id", model.RecordTypeMovie, &model.Rating{
+		RecordId:   "id",
+		RecordType: string(model.RecordTypeMovie),
+		UserId:     "user3",
+		Value:      5,
+	})
+	assert.ErrorIs(t, err, ErrInvalidRating, "a rating without a provider is rejected")
+
+	tests := []struct {
+		name      string
+		providers []string
+		want      *model.AggregatedRating
+		wantErr   error
+	}{
+		{
+			name: "all providers",
+			want: &model.AggregatedRating{Rating: 2, Count: 3, ProviderCounts: map[string]int{model.NativeProviderId: 1, "partner": 2}},
+		},
+		{
+			name:      "native only",
+			providers: []string{model.NativeProviderId},
+			want:      &model.AggregatedRating{Rating: 1, Count: 1, ProviderCounts: map[string]int{model.NativeProviderId: 1}},
+		},
+		{
+			name:      "unknown provider",
+			providers: []string{"unknown"},
+			wantErr:   ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.GetAggregatedRating(ctx, "id", model.RecordTypeMovie, 0, tt.providers)
+			assert.ErrorIs(t, err, tt.wantErr, tt.name)
+			assert.Equal(t, tt.want, got, tt.name)
+		})
+	}
+}
+
+func TestControllerGetAggregatedRatings(t *testing.T) {
+	logger := zap.NewNop()
+	c := New(memory.New(logger), nil, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	ctx := context.Background()
+	for i, v := range []model.RatingValue{4, 5} {
+		err := c.PutRating(ctx, "a", model.RecordTypeMovie, &model.Rating{
+			RecordId:   "a",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     model.UserId(fmt.Sprintf("user%d", i)),
+			Value:      v,
+			ProviderId: model.NativeProviderId,
+		})
+		assert.NoError(t, err)
+	}
+
+	res, err := c.GetAggregatedRatings(ctx, []model.RecordId{"a", "b"}, model.RecordTypeMovie)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RecordAggregate{{RecordId: "a", Rating: 4.5, Count: 2}}, res)
+
+	_, err = c.GetAggregatedRatings(ctx, make([]model.RecordId, MaxBulkRecords+1), model.RecordTypeMovie)
+	assert.ErrorIs(t, err, ErrTooManyRecords)
+
+	_, err = c.GetAggregatedRatings(ctx, []model.RecordId{"a"}, "unknown")
+	assert.ErrorIs(t, err, ErrUnsupportedRecordType)
+}
@@ -0,0 +1,133 @@
+package rating
+
+import (
+	"fmt"
+	"mmoviecom/rating/pkg/model"
+	"sync"
+)
+
+// hub fans out aggregated rating changes to the watchers of a record.
+type hub struct {
+	sync.Mutex
+	watchers map[string]map[*watcher]struct{}
+	records  map[string]*recordLock
+}
+
+// recordLock serializes the notifications of a record.
+type recordLock struct {
+	sync.Mutex
+	refs int
+}
+
+// watcher defines a single record watcher. Its channel holds at most
+// one event, a slow watcher only receives the latest one.
+type watcher struct {
+	key string
+	ch  chan model.AggregatedRatingChangedEvent
+}
+
+func newHub() *hub {
+	return &hub{
+		watchers: map[string]map[*watcher]struct{}{},
+		records:  map[string]*recordLock{},
+	}
+}
+
+func hubKey(recordId model.RecordId, recordType model.RecordType) string {
+	return fmt.Sprintf("%s/%s", recordType, recordId)
+}
+
+// lockRecord locks the notifications of a record and returns the unlock
+// function. Aggregates read and sent under the lock reach the watchers in
+// the order they were read, so an older aggregate never follows a newer one.
+func (h *hub) lockRecord(recordId model.RecordId, recordType model.RecordType) func() {
+	key := hubKey(recordId, recordType)
+	h.Lock()
+	l, ok := h.records[key]
+	if !ok {
+		l = &recordLock{}
+		h.records[key] = l
+	}
+	l.refs++
+	h.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		h.Lock()
+		defer h.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(h.records, key)
+		}
+	}
+}
+
+// subscribe registers a new watcher of a record.
+func (h *hub) subscribe(recordId model.RecordId, recordType model.RecordType) *watcher {
+	w := &watcher{
+		key: hubKey(recordId, recordType),
+		ch:  make(chan model.AggregatedRatingChangedEvent, 1),
+	}
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.watchers[w.key]; !ok {
+		h.watchers[w.key] = map[*watcher]struct{}{}
+	}
+	h.watchers[w.key][w] = struct{}{}
+	return w
+}
+
+// unsubscribe removes a watcher and closes its channel.
+func (h *hub) unsubscribe(w *watcher) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.watchers[w.key], w)
+	if len(h.watchers[w.key]) == 0 {
+		delete(h.watchers, w.key)
+	}
+	close(w.ch)
+}
+
+// watched reports whether a record has any watchers.
+func (h *hub) watched(recordId model.RecordId, recordType model.RecordType) bool {
+	h.Lock()
+	defer h.Unlock()
+	return len(h.watchers[hubKey(recordId, recordType)]) > 0
+}
+
+// broadcast sends an event to all watchers of its record without blocking.
+func (h *hub) broadcast(e model.AggregatedRatingChangedEvent) {
+	h.Lock()
+	defer h.Unlock()
+	for w := range h.watchers[hubKey(e.RecordId, e.RecordType)] {
+		w.offer(e, true)
+	}
+}
+
+// offerInitial sends the current aggregate to a new watcher, replacing
+// a queued event. Callers must hold the record lock, so any queued event
+// is at most as recent.
+func (h *hub) offerInitial(w *watcher, e model.AggregatedRatingChangedEvent) {
+	h.Lock()
+	defer h.Unlock()
+	w.offer(e, true)
+}
+
+// offer queues an event. If the queue is full, the queued event is
+// replaced when replace is set, otherwise the new event is dropped.
+// Callers must hold the hub lock.
+func (w *watcher) offer(e model.AggregatedRatingChangedEvent, replace bool) {
+	for {
+		select {
+		case w.ch <- e:
+			return
+		default:
+		}
+		if !replace {
+			return
+		}
+		select {
+		case <-w.ch:
+		default:
+		}
+	}
+}
@@ -4,37 +4,55 @@ import (
 	"context"
 	"mmoviecom/gen"
 	"mmoviecom/internal/grpcutil"
-	"mmoviecom/pkg/discovery"
+	"mmoviecom/pkg/breaker"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 
 	"go.uber.org/zap"
-	"google.golang.org/grpc/credentials"
 )
 
 type Gateway struct {
-	registry discovery.Registry
-	creds    credentials.TransportCredentials
-	logger   *zap.Logger
+	pool    *grpcutil.ConnPool
+	breaker *breaker.Breaker
+	retrier *retry.Retrier
+	logger  *zap.Logger
 }
 
-func New(registry discovery.Registry, creds credentials.TransportCredentials, logger *zap.Logger) *Gateway {
+func New(pool *grpcutil.ConnPool, breaker *breaker.Breaker, retrier *retry.Retrier, logger *zap.Logger) *Gateway {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "auth-gateway"),
 		zap.String(logging.FieldType, "grpc"),
 	)
-	return &Gateway{registry: registry, creds: creds, logger: logger}
+	return &Gateway{pool: pool, breaker: breaker, retrier: retrier, logger: logger}
+}
+
+// do calls fn through the circuit breaker, retrying failed attempts.
+func (g *Gateway) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return g.breaker.Do(ctx, func(ctx context.Context) error {
+		return g.retrier.Do(ctx, fn)
+	})
 }
 
 func (g *Gateway) ValidateToken(ctx context.Context, token string) (string, error) {
-	conn, err := grpcutil.ServiceConnection(ctx, "auth", g.registry, g.creds)
+	var res string
+	err := g.do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = g.validateToken(ctx, token)
+		return err
+	})
+	return res, err
+}
+
+func (g *Gateway) validateToken(ctx context.Context, token string) (string, error) {
+	conn, err := g.pool.Get("auth")
 	if err != nil {
 		return "", err
 	}
-	defer conn.Close()
 	client := gen.NewAuthServiceClient(conn)
 	resp, err := client.ValidateToken(ctx, &gen.ValidateTokenRequest{Token: token})
 	if err != nil {
-		return "", err
+		return "", errs.FromGRPC(err)
 	}
 	return resp.GetUsername(), nil
 }
@@ -2,30 +2,34 @@ package grpc
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"mmoviecom/gen"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/pkg/metrics"
 	"mmoviecom/rating/internal/controller/rating"
 	"mmoviecom/rating/pkg/model"
+	"strconv"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-var validate = validator.New()
-
 // Handler define a gRPC rating API handler.
 type Handler struct {
 	gen.UnimplementedRatingServiceServer
-	svc                        *rating.Controller
-	logger                     *zap.Logger
-	getAggregatedRatingMetrics *metrics.EndpointMetrics
-	putRatingMetrics           *metrics.EndpointMetrics
+	svc                         *rating.Controller
+	logger                      *zap.Logger
+	getAggregatedRatingMetrics  *metrics.EndpointMetrics
+	getAggregatedRatingsMetrics *metrics.EndpointMetrics
+	putRatingMetrics            *metrics.EndpointMetrics
+	getTrendingMetrics          *metrics.EndpointMetrics
+	getTopRatedMetrics          *metrics.EndpointMetrics
+	listReviewsMetrics          *metrics.EndpointMetrics
+	moderateReviewMetrics       *metrics.EndpointMetrics
+	watchMetrics                *metrics.EndpointMetrics
 }
 
 // New creates a new rating gRPC handler.
@@ -35,10 +39,16 @@ func New(svc *rating.Controller, logger *zap.Logger, scope tally.Scope) *Handler
 		zap.String(logging.FieldType, "grpc"),
 	)
 	return &Handler{
-		svc:                        svc,
-		logger:                     logger,
-		getAggregatedRatingMetrics: metrics.NewEndpointMetrics(scope, "GetAggregatedRating"),
-		putRatingMetrics:           metrics.NewEndpointMetrics(scope, "PutRating"),
+		svc:                         svc,
+		logger:                      logger,
+		getAggregatedRatingMetrics:  metrics.NewEndpointMetrics(scope, "GetAggregatedRating"),
+		getAggregatedRatingsMetrics: metrics.NewEndpointMetrics(scope, "GetAggregatedRatings"),
+		putRatingMetrics:            metrics.NewEndpointMetrics(scope, "PutRating"),
+		getTrendingMetrics:          metrics.NewEndpointMetrics(scope, "GetTrending"),
+		getTopRatedMetrics:          metrics.NewEndpointMetrics(scope, "GetTopRated"),
+		listReviewsMetrics:          metrics.NewEndpointMetrics(scope, "ListReviews"),
+		moderateReviewMetrics:       metrics.NewEndpointMetrics(scope, "ModerateReview"),
+		watchMetrics:                metrics.NewEndpointMetrics(scope, "WatchAggregatedRating"),
 	}
 }
 
@@ -49,16 +59,64 @@ func (h *Handler) GetAggregatedRating(ctx context.Context, req *gen.GetAggregate
 		h.getAggregatedRatingMetrics.InvalidArgumentErrors.Inc(1)
 		return nil, status.Error(codes.InvalidArgument, "nil req or empty id/type")
 	}
-	v, err := h.svc.GetAggregatedRating(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType))
-	if err != nil && errors.Is(err, rating.ErrNotFound) {
-		h.getAggregatedRatingMetrics.NotFoundErrors.Inc(1)
-		return nil, status.Error(codes.NotFound, err.Error())
-	} else if err != nil {
-		h.getAggregatedRatingMetrics.InternalErrors.Inc(1)
-		return nil, status.Error(codes.Internal, err.Error())
+	window := time.Duration(req.WindowSeconds) * time.Second
+	agg, err := h.svc.GetAggregatedRating(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType), window, req.ProviderIds)
+	if err != nil {
+		h.getAggregatedRatingMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	h.getAggregatedRatingMetrics.Successes.Inc(1)
-	return &gen.GetAggregatedRatingResponse{RatingValue: v}, nil
+	return model.AggregatedRatingToProto(agg), nil
+}
+
+// GetAggregatedRatings returns the aggregated ratings of multiple records.
+// Records without ratings are omitted from the response.
+func (h *Handler) GetAggregatedRatings(ctx context.Context, req *gen.GetAggregatedRatingsRequest) (*gen.GetAggregatedRatingsResponse, error) {
+	h.getAggregatedRatingsMetrics.Calls.Inc(1)
+	if req == nil || req.RecordType == "" {
+		h.getAggregatedRatingsMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or empty type")
+	}
+	recordIds := make([]model.RecordId, 0, len(req.RecordIds))
+	for _, id := range req.RecordIds {
+		recordIds = append(recordIds, model.RecordId(id))
+	}
+	records, err := h.svc.GetAggregatedRatings(ctx, recordIds, model.RecordType(req.RecordType))
+	if err != nil {
+		h.getAggregatedRatingsMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.GetAggregatedRatingsResponse{}
+	for i := range records {
+		resp.Records = append(resp.Records, model.RecordAggregateToProto(&records[i]))
+	}
+	h.getAggregatedRatingsMetrics.Successes.Inc(1)
+	return resp, nil
+}
+
+// WatchAggregatedRating streams the aggregated rating of a record on every change
+// until the client disconnects.
+func (h *Handler) WatchAggregatedRating(req *gen.WatchAggregatedRatingRequest, stream gen.RatingService_WatchAggregatedRatingServer) error {
+	h.watchMetrics.Calls.Inc(1)
+	if req == nil || req.RecordId == "" || req.RecordType == "" {
+		h.watchMetrics.InvalidArgumentErrors.Inc(1)
+		return status.Error(codes.InvalidArgument, "nil req or empty id/type")
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	events, err := h.svc.WatchAggregatedRating(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType))
+	if err != nil {
+		h.watchMetrics.IncError(err)
+		return errs.ToGRPC(err)
+	}
+	for e := range events {
+		if err := stream.Send(&gen.WatchAggregatedRatingResponse{RatingValue: e.Rating, Count: int32(e.Count)}); err != nil {
+			h.logger.Debug("Watcher disconnected", zap.String("recordId", req.RecordId), zap.Error(err))
+			return err
+		}
+	}
+	h.watchMetrics.Successes.Inc(1)
+	return nil
 }
 
 // PutRating writes a rating for a given record.
@@ -68,19 +126,133 @@ func (h *Handler) PutRating(ctx context.Context, req *gen.PutRatingRequest) (*ge
 		h.putRatingMetrics.InvalidArgumentErrors.Inc(1)
 		return nil, status.Error(codes.InvalidArgument, "nil req")
 	}
-	record := model.Rating{UserId: model.UserId(req.UserId), Value: model.RatingValue(req.RatingValue)}
-	if err := validate.Struct(record); err != nil {
-		h.logger.Error("Rating validation failed", zap.Error(err))
-		return nil, fmt.Errorf("rating validation failed")
+	recordId, recordType := model.RecordId(req.RecordId), model.RecordType(req.RecordType)
+	record := model.Rating{
+		RecordId:   req.RecordId,
+		RecordType: req.RecordType,
+		UserId:     model.UserId(req.UserId),
+		Value:      model.RatingValue(req.RatingValue),
+		ProviderId: model.NativeProviderId,
+		Review:     req.Review,
+	}
+	if err := h.svc.ValidateRating(recordId, recordType, &record); err != nil {
+		h.logger.Warn("Rating validation failed", zap.Error(err))
+		h.putRatingMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	if err := h.svc.ValidateToken(ctx, req.GetToken(), &record); err != nil {
-		h.putRatingMetrics.InvalidArgumentErrors.Inc(1)
-		return nil, status.Error(codes.InvalidArgument, err.Error())
+		h.putRatingMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
-	if err := h.svc.PutRating(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType), &record); err != nil {
-		h.putRatingMetrics.InternalErrors.Inc(1)
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := h.svc.PutRating(ctx, recordId, recordType, &record); err != nil {
+		h.putRatingMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
 	}
 	h.putRatingMetrics.Successes.Inc(1)
 	return &gen.PutRatingResponse{}, nil
 }
+
+// GetTrending returns records ranked by rating velocity over a time window.
+func (h *Handler) GetTrending(ctx context.Context, req *gen.GetTrendingRequest) (*gen.GetTrendingResponse, error) {
+	h.getTrendingMetrics.Calls.Inc(1)
+	if req == nil || req.RecordType == "" {
+		h.getTrendingMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or empty type")
+	}
+	window := time.Duration(req.WindowSeconds) * time.Second
+	records, err := h.svc.GetTrending(ctx, model.RecordType(req.RecordType), window, int(req.Limit))
+	if err != nil {
+		h.getTrendingMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.GetTrendingResponse{}
+	for i := range records {
+		resp.Records = append(resp.Records, model.TrendingRecordToProto(&records[i]))
+	}
+	h.getTrendingMetrics.Successes.Inc(1)
+	return resp, nil
+}
+
+// GetTopRated returns a page of records ordered by aggregated rating.
+func (h *Handler) GetTopRated(ctx context.Context, req *gen.GetTopRatedRequest) (*gen.GetTopRatedResponse, error) {
+	h.getTopRatedMetrics.Calls.Inc(1)
+	if req == nil || req.RecordType == "" {
+		h.getTopRatedMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or empty type")
+	}
+	var offset int
+	if req.PageToken != "" {
+		v, err := strconv.Atoi(req.PageToken)
+		if err != nil || v < 0 {
+			h.getTopRatedMetrics.InvalidArgumentErrors.Inc(1)
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		offset = v
+	}
+	records, next, err := h.svc.GetTopRated(ctx, model.RecordType(req.RecordType), int(req.MinVotes), offset, int(req.PageSize))
+	if err != nil {
+		h.getTopRatedMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.GetTopRatedResponse{}
+	for i := range records {
+		resp.Records = append(resp.Records, model.RecordAggregateToProto(&records[i]))
+	}
+	if next > 0 {
+		resp.NextPageToken = strconv.Itoa(next)
+	}
+	h.getTopRatedMetrics.Successes.Inc(1)
+	return resp, nil
+}
+
+// ListReviews returns a page of approved reviews of a record.
+func (h *Handler) ListReviews(ctx context.Context, req *gen.ListReviewsRequest) (*gen.ListReviewsResponse, error) {
+	h.listReviewsMetrics.Calls.Inc(1)
+	if req == nil || req.RecordId == "" || req.RecordType == "" {
+		h.listReviewsMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or empty id/type")
+	}
+	var offset int
+	if req.PageToken != "" {
+		v, err := strconv.Atoi(req.PageToken)
+		if err != nil || v < 0 {
+			h.listReviewsMetrics.InvalidArgumentErrors.Inc(1)
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		offset = v
+	}
+	reviews, next, err := h.svc.ListReviews(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType), offset, int(req.PageSize))
+	if err != nil {
+		h.listReviewsMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	resp := &gen.ListReviewsResponse{}
+	for i := range reviews {
+		resp.Reviews = append(resp.Reviews, model.ReviewToProto(&reviews[i]))
+	}
+	if next > 0 {
+		resp.NextPageToken = strconv.Itoa(next)
+	}
+	h.listReviewsMetrics.Successes.Inc(1)
+	return resp, nil
+}
+
+// ModerateReview sets the moderation status of a review. Only admins are allowed to moderate reviews.
+func (h *Handler) ModerateReview(ctx context.Context, req *gen.ModerateReviewRequest) (*gen.ModerateReviewResponse, error) {
+	h.moderateReviewMetrics.Calls.Inc(1)
+	if req == nil || req.RecordId == "" || req.RecordType == "" || req.UserId == "" {
+		h.moderateReviewMetrics.InvalidArgumentErrors.Inc(1)
+		return nil, status.Error(codes.InvalidArgument, "nil req or empty id/type/user")
+	}
+	if err := h.svc.ValidateAdminToken(ctx, req.Token); err != nil {
+		h.moderateReviewMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	err := h.svc.ModerateReview(ctx, model.RecordId(req.RecordId), model.RecordType(req.RecordType), model.UserId(req.UserId), model.ReviewStatus(req.Status))
+	if err != nil {
+		h.moderateReviewMetrics.IncError(err)
+		return nil, errs.ToGRPC(err)
+	}
+	h.moderateReviewMetrics.Successes.Inc(1)
+	return &gen.ModerateReviewResponse{}, nil
+}
@@ -2,12 +2,13 @@ package http
 
 import (
 	"encoding/json"
-	"errors"
+	"mmoviecom/pkg/errs"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/rating/internal/controller/rating"
 	"mmoviecom/rating/pkg/model"
 	"net/http"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -49,12 +50,21 @@ func (h *Handler) Handle(w http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodGet:
-		v, err := h.ctrl.GetAggregatedRating(req.Context(), recordId, recordType)
-		if err != nil && errors.Is(err, rating.ErrNotFound) {
-			w.WriteHeader(http.StatusNotFound)
+		var window time.Duration
+		if v := req.FormValue("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		agg, err := h.ctrl.GetAggregatedRating(req.Context(), recordId, recordType, window, req.Form["provider"])
+		if err != nil {
+			w.WriteHeader(errs.HTTPStatus(err))
 			return
 		}
-		if err := json.NewEncoder(w).Encode(v); err != nil {
+		if err := json.NewEncoder(w).Encode(agg.Rating); err != nil {
 			h.logger.Warn("Response encode error", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -66,14 +76,27 @@ func (h *Handler) Handle(w http.ResponseWriter, req *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		record := model.Rating{UserId: userId, Value: model.RatingValue(v)}
+		record := model.Rating{
+			RecordId:   string(recordId),
+			RecordType: string(recordType),
+			UserId:     userId,
+			Value:      model.RatingValue(v),
+			ProviderId: model.NativeProviderId,
+			Review:     req.FormValue("review"),
+		}
+		if err := h.ctrl.ValidateRating(recordId, recordType, &record); err != nil {
+			h.logger.Warn("Rating validation failed", zap.Error(err))
+			w.WriteHeader(errs.HTTPStatus(err))
+			return
+		}
 		if err := h.ctrl.ValidateToken(req.Context(), token, &record); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(errs.HTTPStatus(err))
+			return
 		}
 
 		if err := h.ctrl.PutRating(req.Context(), recordId, recordType, &record); err != nil {
 			h.logger.Warn("Repository put error", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(errs.HTTPStatus(err))
 		}
 	default:
 		w.WriteHeader(http.StatusBadRequest)
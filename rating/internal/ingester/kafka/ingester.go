@@ -3,10 +3,15 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"mmoviecom/gen"
 	"mmoviecom/pkg/logging"
+	"strconv"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 
 	"mmoviecom/rating/pkg/model"
 )
@@ -16,10 +21,11 @@ type Ingester struct {
 	consumer *kafka.Consumer
 	topic    string
 	logger   *zap.Logger
+	scope    tally.Scope
 }
 
 // NewIngester creates a new Kafka ingester.
-func NewIngester(addr string, groupID string, topic string, logger *zap.Logger) (*Ingester, error) {
+func NewIngester(addr string, groupID string, topic string, logger *zap.Logger, scope tally.Scope) (*Ingester, error) {
 	logger = logger.With(
 		zap.String(logging.FieldComponent, "kafka-ingester"),
 		zap.String("topic", topic),
@@ -32,7 +38,11 @@ func NewIngester(addr string, groupID string, topic string, logger *zap.Logger)
 	if err != nil {
 		return nil, err
 	}
-	return &Ingester{consumer: consumer, topic: topic, logger: logger}, nil
+	scope = scope.Tagged(map[string]string{
+		"component": "kafka-ingester",
+		"topic":     topic,
+	})
+	return &Ingester{consumer: consumer, topic: topic, logger: logger, scope: scope}, nil
 }
 
 // Ingest starts ingestion from Kafka and returns a channel containing
@@ -49,7 +59,10 @@ func (i *Ingester) Ingest(ctx context.Context) (chan model.RatingEvent, error) {
 			select {
 			case <-ctx.Done():
 				close(ch)
-				i.consumer.Close()
+				if err := i.consumer.Close(); err != nil {
+					i.logger.Warn("Failed to close consumer", zap.Error(err))
+				}
+				return
 			default:
 				msg, err := i.consumer.ReadMessage(-1)
 				if err != nil {
@@ -57,14 +70,74 @@ func (i *Ingester) Ingest(ctx context.Context) (chan model.RatingEvent, error) {
 					continue
 				}
 				i.logger.Info("Processing a message")
-				var event model.RatingEvent
-				if err := json.Unmarshal(msg.Value, &event); err != nil {
+				i.reportLag(msg.TopicPartition)
+				event, err := decodeEvent(msg)
+				if err != nil {
 					i.logger.Warn("Unmarshal error", zap.Error(err))
 					continue
 				}
-				ch <- event
+				if event.SchemaVersion > model.RatingEventSchemaVersion {
+					i.logger.Warn("Rating event schema version is newer than supported, unknown fields are ignored",
+						zap.Int("schemaVersion", event.SchemaVersion),
+						zap.Int("supportedSchemaVersion", model.RatingEventSchemaVersion),
+					)
+				}
+				ch <- *event
 			}
 		}
 	}()
 	return ch, nil
 }
+
+// reportLag reports the consumer lag of a partition, computed from the
+// cached high watermark and the offset of the message just read.
+func (i *Ingester) reportLag(tp kafka.TopicPartition) {
+	_, high, err := i.consumer.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+	if err != nil {
+		i.logger.Debug("Failed to get watermark offsets", zap.Error(err))
+		return
+	}
+	lag := high - int64(tp.Offset) - 1
+	if lag < 0 {
+		lag = 0
+	}
+	i.scope.Tagged(map[string]string{
+		"partition": strconv.Itoa(int(tp.Partition)),
+	}).Gauge("consumer_lag").Update(float64(lag))
+}
+
+// decodeEvent decodes a rating event according to the message content type.
+// Messages without a content type are treated as JSON. Events without their
+// own update time are timestamped with the message time, so replayed events
+// keep the time they were produced at.
+func decodeEvent(msg *kafka.Message) (*model.RatingEvent, error) {
+	contentType := model.ContentTypeJSON
+	for _, h := range msg.Headers {
+		if h.Key == model.ContentTypeHeader {
+			contentType = string(h.Value)
+		}
+	}
+	var event *model.RatingEvent
+	switch contentType {
+	case model.ContentTypeJSON:
+		event = &model.RatingEvent{}
+		if err := json.Unmarshal(msg.Value, event); err != nil {
+			return nil, err
+		}
+	case model.ContentTypeProtobuf:
+		var p gen.RatingEvent
+		if err := proto.Unmarshal(msg.Value, &p); err != nil {
+			return nil, err
+		}
+		event = model.RatingEventFromProto(&p)
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = 1
+	}
+	if event.UpdatedAt.IsZero() && msg.TimestampType != kafka.TimestampNotAvailable {
+		event.UpdatedAt = msg.Timestamp
+	}
+	return event, nil
+}
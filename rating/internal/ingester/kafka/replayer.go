@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"mmoviecom/pkg/logging"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.uber.org/zap"
+
+	"mmoviecom/rating/pkg/model"
+)
+
+// requestTimeout defines how long the replayer waits for Kafka metadata requests.
+const requestTimeout = 10 * time.Second
+
+// pollTimeout defines how long the replayer waits for a single message.
+const pollTimeout = time.Second
+
+// ReplayRange defines a range of topic messages to replay. Messages are
+// replayed from StartOffset of every partition, or from StartTime if it
+// is set, up to the end of the partition at the moment the replay starts.
+// If EndTime is set, messages produced after it are skipped.
+type ReplayRange struct {
+	StartOffset int64
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// Replayer defines a Kafka reader of a bounded range of rating events.
+// Unlike Ingester, it does not join a consumer group and does not commit
+// offsets, so replays do not affect the regular ingestion.
+type Replayer struct {
+	consumer     *kafka.Consumer
+	topic        string
+	rng          ReplayRange
+	logger       *zap.Logger
+	decodeErrors atomic.Int64
+}
+
+// NewReplayer creates a new Kafka replayer.
+func NewReplayer(addr string, topic string, rng ReplayRange, logger *zap.Logger) (*Replayer, error) {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "kafka-replayer"),
+		zap.String("topic", topic),
+	)
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  addr,
+		"group.id":           "rating-replay",
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{consumer: consumer, topic: topic, rng: rng, logger: logger}, nil
+}
+
+// Ingest starts the replay and returns a channel containing the replayed
+// rating events. The channel is closed once the range is consumed or ctx is done.
+func (r *Replayer) Ingest(ctx context.Context) (chan model.RatingEvent, error) {
+	partitions, err := r.assignments()
+	if err != nil {
+		return nil, err
+	}
+	ends := map[int32]int64{}
+	var tps []kafka.TopicPartition
+	for _, p := range partitions {
+		ends[p.partition] = p.end
+		tps = append(tps, kafka.TopicPartition{Topic: &r.topic, Partition: p.partition, Offset: kafka.Offset(p.start)})
+		r.logger.Info("Replaying partition", zap.Int32("partition", p.partition), zap.Int64("start", p.start), zap.Int64("end", p.end))
+	}
+	if err := r.consumer.Assign(tps); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan model.RatingEvent, 1)
+	go func() {
+		defer func() {
+			close(ch)
+			if err := r.consumer.Close(); err != nil {
+				r.logger.Warn("Failed to close consumer", zap.Error(err))
+			}
+		}()
+		for len(ends) > 0 && ctx.Err() == nil {
+			msg, err := r.consumer.ReadMessage(pollTimeout)
+			var kafkaErr kafka.Error
+			if err != nil && errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+				continue
+			} else if err != nil {
+				r.logger.Warn("Consumer error", zap.Error(err))
+				continue
+			}
+			tp := msg.TopicPartition
+			if end, ok := ends[tp.Partition]; ok && int64(tp.Offset)+1 >= end {
+				delete(ends, tp.Partition)
+			}
+			if !r.rng.EndTime.IsZero() && msg.Timestamp.After(r.rng.EndTime) {
+				continue
+			}
+			event, err := decodeEvent(msg)
+			if err != nil {
+				r.decodeErrors.Add(1)
+				r.logger.Warn("Unmarshal error", zap.Int32("partition", tp.Partition), zap.Int64("offset", int64(tp.Offset)), zap.Error(err))
+				continue
+			}
+			select {
+			case ch <- *event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// DecodeErrors returns the number of replayed messages that failed to decode.
+func (r *Replayer) DecodeErrors() int {
+	return int(r.decodeErrors.Load())
+}
+
+// partitionRange defines the offsets of a partition to replay, end is exclusive.
+type partitionRange struct {
+	partition int32
+	start     int64
+	end       int64
+}
+
+// assignments returns the offset ranges to replay of all non-empty topic partitions.
+func (r *Replayer) assignments() ([]partitionRange, error) {
+	timeout := int(requestTimeout.Milliseconds())
+	md, err := r.consumer.GetMetadata(&r.topic, false, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var res []partitionRange
+	for _, p := range md.Topics[r.topic].Partitions {
+		low, high, err := r.consumer.QueryWatermarkOffsets(r.topic, p.ID, timeout)
+		if err != nil {
+			return nil, err
+		}
+		start := max(r.rng.StartOffset, low)
+		if !r.rng.StartTime.IsZero() {
+			offsets, err := r.consumer.OffsetsForTimes([]kafka.TopicPartition{
+				{Topic: &r.topic, Partition: p.ID, Offset: kafka.Offset(r.rng.StartTime.UnixMilli())},
+			}, timeout)
+			if err != nil {
+				return nil, err
+			}
+			if len(offsets) == 0 || offsets[0].Offset < 0 {
+				// No messages since the start time.
+				continue
+			}
+			start = int64(offsets[0].Offset)
+		}
+		if start >= high {
+			continue
+		}
+		res = append(res, partitionRange{partition: p.ID, start: start, end: high})
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mmoviecom/pkg/logging"
+	"mmoviecom/rating/pkg/model"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+// flushTimeout defines how long Close waits for outstanding messages.
+const flushTimeout = 10 * time.Second
+
+// ErrClosed is returned when publishing to a closed publisher.
+var ErrClosed = errors.New("publisher is closed")
+
+// Publisher defines a Kafka publisher of aggregated rating change events.
+// If debounce is set, events of the same record published within the debounce
+// window are coalesced and only the latest one is sent. Events are produced
+// under the publisher lock, so no event is produced once it is closed.
+type Publisher struct {
+	sync.Mutex
+	producer  *kafka.Producer
+	topic     string
+	debounce  time.Duration
+	pending   map[string]*model.AggregatedRatingChangedEvent
+	timers    map[string]*time.Timer
+	closed    bool
+	logger    *zap.Logger
+	published tally.Counter
+	failed    tally.Counter
+}
+
+// NewPublisher creates a new Kafka publisher.
+func NewPublisher(addr string, topic string, debounce time.Duration, logger *zap.Logger, scope tally.Scope) (*Publisher, error) {
+	logger = logger.With(
+		zap.String(logging.FieldComponent, "kafka-publisher"),
+		zap.String("topic", topic),
+	)
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": addr})
+	if err != nil {
+		return nil, err
+	}
+	scope = scope.Tagged(map[string]string{
+		"component": "kafka-publisher",
+		"topic":     topic,
+	})
+	p := &Publisher{
+		producer:  producer,
+		topic:     topic,
+		debounce:  debounce,
+		pending:   map[string]*model.AggregatedRatingChangedEvent{},
+		timers:    map[string]*time.Timer{},
+		logger:    logger,
+		published: scope.Counter("events_published"),
+		failed:    scope.Counter("events_failed"),
+	}
+	go p.handleDeliveries()
+	return p, nil
+}
+
+// Publish publishes an aggregated rating change event.
+// It returns ErrClosed once the publisher is closed.
+func (p *Publisher) Publish(_ context.Context, event *model.AggregatedRatingChangedEvent) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	if p.debounce <= 0 {
+		return p.produce(event)
+	}
+	key := fmt.Sprintf("%s/%s", event.RecordType, event.RecordId)
+	if _, ok := p.pending[key]; !ok {
+		p.timers[key] = time.AfterFunc(p.debounce, func() {
+			p.flush(key)
+		})
+	}
+	p.pending[key] = event
+	return nil
+}
+
+// Close stops the debounce timers, sends pending events and waits for
+// outstanding deliveries. Closing a closed publisher does nothing.
+func (p *Publisher) Close() {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return
+	}
+	p.closed = true
+	for key, timer := range p.timers {
+		timer.Stop()
+		delete(p.timers, key)
+	}
+	for key, event := range p.pending {
+		delete(p.pending, key)
+		if err := p.produce(event); err != nil {
+			p.logger.Warn("Failed to publish event", zap.Stringer("event", event), zap.Error(err))
+		}
+	}
+	p.Unlock()
+	p.producer.Flush(int(flushTimeout.Milliseconds()))
+	p.producer.Close()
+}
+
+// flush sends the pending event of a record, if any. Pending events
+// of a closed publisher are sent by Close.
+func (p *Publisher) flush(key string) {
+	p.Lock()
+	defer p.Unlock()
+	event, ok := p.pending[key]
+	if p.closed || !ok {
+		return
+	}
+	delete(p.pending, key)
+	delete(p.timers, key)
+	if err := p.produce(event); err != nil {
+		p.logger.Warn("Failed to publish event", zap.Stringer("event", event), zap.Error(err))
+	}
+}
+
+// produce enqueues an event to the Kafka producer.
+// Callers must hold the publisher lock.
+func (p *Publisher) produce(event *model.AggregatedRatingChangedEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := p.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &p.topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:   []byte(fmt.Sprintf("%s/%s", event.RecordType, event.RecordId)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: model.ContentTypeHeader, Value: []byte(model.ContentTypeJSON)},
+		},
+	}, nil); err != nil {
+		p.failed.Inc(1)
+		return err
+	}
+	return nil
+}
+
+// handleDeliveries reports delivery results of produced messages.
+func (p *Publisher) handleDeliveries() {
+	for e := range p.producer.Events() {
+		msg, ok := e.(*kafka.Message)
+		if !ok {
+			continue
+		}
+		if msg.TopicPartition.Error != nil {
+			p.failed.Inc(1)
+			p.logger.Warn("Failed to deliver event", zap.Error(msg.TopicPartition.Error))
+			continue
+		}
+		p.published.Inc(1)
+	}
+}
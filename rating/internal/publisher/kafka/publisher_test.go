@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"context"
+	"mmoviecom/rating/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+func TestPublisherClose(t *testing.T) {
+	p, err := NewPublisher("localhost:1", "ratings", time.Hour, zap.NewNop(), tally.NoopScope)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p.Close()
+	p.Close()
+
+	err = p.Publish(context.Background(), &model.AggregatedRatingChangedEvent{RecordId: "id", RecordType: model.RecordTypeMovie})
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.Empty(t, p.timers, "no debounce timer is started after Close")
+}
@@ -0,0 +1,81 @@
+package recordtype
+
+import (
+	"errors"
+	"fmt"
+	"mmoviecom/rating/configs"
+	"mmoviecom/rating/pkg/model"
+	"regexp"
+)
+
+// ErrValueOutOfRange is returned when a rating value is outside of the record type range.
+var ErrValueOutOfRange = errors.New("rating value out of range")
+
+// ErrInvalidRecordId is returned when a record id does not match the record type pattern.
+var ErrInvalidRecordId = errors.New("invalid record id")
+
+// Rules defines validation rules of a record type.
+type Rules struct {
+	MinValue  model.RatingValue
+	MaxValue  model.RatingValue
+	idPattern *regexp.Regexp
+}
+
+// Validate checks a rating against the record type rules.
+func (r *Rules) Validate(recordId model.RecordId, value model.RatingValue) error {
+	if value < r.MinValue || value > r.MaxValue {
+		return fmt.Errorf("%w: %d not in [%d, %d]", ErrValueOutOfRange, value, r.MinValue, r.MaxValue)
+	}
+	if r.idPattern != nil && !r.idPattern.MatchString(string(recordId)) {
+		return fmt.Errorf("%w: %s does not match %s", ErrInvalidRecordId, recordId, r.idPattern)
+	}
+	return nil
+}
+
+// Registry defines a registry of supported record types.
+type Registry struct {
+	rules map[model.RecordType]*Rules
+}
+
+// New creates a record type registry from configuration. If no record
+// types are configured, the default registry is returned.
+func New(cfg []configs.RecordTypeConfig) (*Registry, error) {
+	if len(cfg) == 0 {
+		return Default(), nil
+	}
+	r := &Registry{rules: map[model.RecordType]*Rules{}}
+	for _, c := range cfg {
+		if c.Name == "" {
+			return nil, errors.New("record type name is empty")
+		}
+		if _, ok := r.rules[model.RecordType(c.Name)]; ok {
+			return nil, fmt.Errorf("duplicate record type: %s", c.Name)
+		}
+		if c.MinValue > c.MaxValue {
+			return nil, fmt.Errorf("record type %s: minValue is greater than maxValue", c.Name)
+		}
+		rules := &Rules{MinValue: model.RatingValue(c.MinValue), MaxValue: model.RatingValue(c.MaxValue)}
+		if c.IdPattern != "" {
+			p, err := regexp.Compile(c.IdPattern)
+			if err != nil {
+				return nil, fmt.Errorf("record type %s: %w", c.Name, err)
+			}
+			rules.idPattern = p
+		}
+		r.rules[model.RecordType(c.Name)] = rules
+	}
+	return r, nil
+}
+
+// Default returns a registry supporting movies rated from 1 to 5.
+func Default() *Registry {
+	return &Registry{rules: map[model.RecordType]*Rules{
+		model.RecordTypeMovie: {MinValue: 1, MaxValue: 5},
+	}}
+}
+
+// Get returns the rules of a record type and whether the record type is supported.
+func (r *Registry) Get(recordType model.RecordType) (*Rules, bool) {
+	rules, ok := r.rules[recordType]
+	return rules, ok
+}
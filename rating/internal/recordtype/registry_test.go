@@ -0,0 +1,75 @@
+package recordtype
+
+import (
+	"errors"
+	"mmoviecom/rating/configs"
+	"mmoviecom/rating/pkg/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	registry, err := New([]configs.RecordTypeConfig{
+		{Name: "movie", MinValue: 1, MaxValue: 5},
+		{Name: "episode", MinValue: 1, MaxValue: 10, IdPattern: `^s\d+e\d+$`},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		recordType model.RecordType
+		recordId   model.RecordId
+		value      model.RatingValue
+		supported  bool
+		wantErr    error
+	}{
+		{
+			name:       "valid movie",
+			recordType: model.RecordTypeMovie,
+			recordId:   "the-movie",
+			value:      5,
+			supported:  true,
+		},
+		{
+			name:       "movie value out of range",
+			recordType: model.RecordTypeMovie,
+			recordId:   "the-movie",
+			value:      7,
+			supported:  true,
+			wantErr:    ErrValueOutOfRange,
+		},
+		{
+			name:       "valid episode",
+			recordType: model.RecordTypeEpisode,
+			recordId:   "s01e02",
+			value:      7,
+			supported:  true,
+		},
+		{
+			name:       "invalid episode id",
+			recordType: model.RecordTypeEpisode,
+			recordId:   "the-movie",
+			value:      7,
+			supported:  true,
+			wantErr:    ErrInvalidRecordId,
+		},
+		{
+			name:       "unsupported record type",
+			recordType: model.RecordTypeSeries,
+			supported:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, ok := registry.Get(tt.recordType)
+			assert.Equal(t, tt.supported, ok, tt.name)
+			if !ok {
+				return
+			}
+			err := rules.Validate(tt.recordId, tt.value)
+			assert.True(t, errors.Is(err, tt.wantErr), tt.name)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mmoviecom/pkg/logging"
+	"mmoviecom/rating/configs"
+	"mmoviecom/rating/internal/controller/rating"
+	"mmoviecom/rating/internal/ingester/kafka"
+	"mmoviecom/rating/internal/recordtype"
+	ratingrepository "mmoviecom/rating/internal/repository"
+	"mmoviecom/rating/internal/repository/memory"
+	"mmoviecom/rating/internal/repository/mysql"
+	"mmoviecom/rating/pkg/model"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+// Config defines a replay configuration. Events are replayed from StartOffset
+// of every partition, or from StartTime if it is set, and optionally up to
+// EndTime. If RecordIds or Providers are set, only matching events are replayed.
+// A dry run applies events to an in-memory repository instead of MySQL.
+type Config struct {
+	KafkaAddress string
+	Topic        string
+	StartOffset  int64
+	StartTime    time.Time
+	EndTime      time.Time
+	RecordType   model.RecordType
+	RecordIds    []model.RecordId
+	Providers    []string
+	DryRun       bool
+	Mysql        configs.MysqlConfig
+	RecordTypes  []configs.RecordTypeConfig
+	Ingestion    configs.IngestionConfig
+}
+
+// Report defines the outcome of a replay. Applied, Providers and Records
+// count the events written to the repository, Outdated counts the events
+// older than the stored ratings, which are not written.
+type Report struct {
+	Read         int
+	DecodeErrors int
+	Filtered     int
+	Invalid      int
+	Outdated     int
+	Applied      int
+	Providers    map[string]int
+	Records      map[string]int
+}
+
+// String returns a human-readable report.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "read: %d\ndecode errors: %d\nfiltered out: %d\ninvalid: %d\noutdated: %d\napplied: %d\n",
+		r.Read, r.DecodeErrors, r.Filtered, r.Invalid, r.Outdated, r.Applied)
+	writeCounts(&b, "providers", r.Providers)
+	writeCounts(&b, "records", r.Records)
+	return b.String()
+}
+
+func writeCounts(b *strings.Builder, title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(b, "%s: %d\n", title, len(keys))
+	for _, k := range keys {
+		fmt.Fprintf(b, "  %s: %d\n", k, counts[k])
+	}
+}
+
+// Run replays rating events through the rating controller and returns the report.
+// Replayed ratings keep the time of their events, so they are aggregated in the
+// time windows they were produced in. Events older than the stored ratings are
+// not applied, so a replay never overwrites newer ratings. Aggregated rating
+// changes are not published during a replay.
+func Run(ctx context.Context, cfg Config, logger *zap.Logger, scope tally.Scope) (*Report, error) {
+	logger = logger.With(
+		zap.String(logging.FieldService, "rating-replay"),
+	)
+	recordTypes, err := recordtype.New(cfg.RecordTypes)
+	if err != nil {
+		return nil, err
+	}
+	replayer, err := kafka.NewReplayer(cfg.KafkaAddress, cfg.Topic, kafka.ReplayRange{
+		StartOffset: cfg.StartOffset,
+		StartTime:   cfg.StartTime,
+		EndTime:     cfg.EndTime,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	f := &filter{
+		source: replayer,
+		cfg:    cfg,
+		done:   make(chan struct{}),
+		report: &Report{Providers: map[string]int{}, Records: map[string]int{}},
+	}
+	var repo repository = memory.New(logger)
+	if !cfg.DryRun {
+		if repo, err = mysql.New(cfg.Mysql, logger); err != nil {
+			return nil, err
+		}
+	}
+	ctrl := rating.New(&applyCounter{repository: repo, report: f.report}, f, nil, nil, recordTypes, nil, logger, scope)
+	f.validate = ctrl.ValidateRating
+
+	ctx, cancel := context.WithCancel(ctx)
+	err = ctrl.StartIngestion(ctx, cfg.Ingestion.Workers, cfg.Ingestion.QueueSize)
+	// Unblock the filter if the ingestion stopped early.
+	cancel()
+	<-f.done
+	f.report.DecodeErrors = replayer.DecodeErrors()
+	return f.report, err
+}
+
+// repository defines the rating repository events are applied to.
+type repository interface {
+	Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, record *model.Rating) error
+	Aggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType, since time.Time, providers []string) (*model.AggregatedRating, error)
+	ListTrending(ctx context.Context, recordType model.RecordType, since time.Time, limit int) ([]model.RecordAggregate, error)
+	ListTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, limit int) ([]model.RecordAggregate, error)
+	ListAggregates(ctx context.Context, recordType model.RecordType, recordIds []model.RecordId) ([]model.RecordAggregate, error)
+	ListReviews(ctx context.Context, recordId model.RecordId, recordType model.RecordType, status model.ReviewStatus, offset int, limit int) ([]model.Rating, error)
+	SetReviewStatus(ctx context.Context, recordId model.RecordId, recordType model.RecordType, userId model.UserId, status model.ReviewStatus) error
+}
+
+// applyCounter defines a repository counting the ratings written
+// successfully in the replay report.
+type applyCounter struct {
+	repository
+	mu     sync.Mutex
+	report *Report
+}
+
+// Put writes a rating and counts it once it is written.
+func (a *applyCounter) Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, record *model.Rating) error {
+	err := a.repository.Put(ctx, recordId, recordType, record)
+	if err != nil && errors.Is(err, ratingrepository.ErrOutdated) {
+		a.mu.Lock()
+		a.report.Outdated++
+		a.mu.Unlock()
+		return err
+	} else if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.report.Applied++
+	a.report.Providers[record.ProviderId]++
+	a.report.Records[string(recordType)+"/"+string(recordId)]++
+	return nil
+}
+
+// ingester defines a source of rating events.
+type ingester interface {
+	Ingest(ctx context.Context) (chan model.RatingEvent, error)
+}
+
+// filter defines an ingester passing through replayed events
+// that match the replay filters and are valid.
+type filter struct {
+	source   ingester
+	cfg      Config
+	validate func(model.RecordId, model.RecordType, *model.Rating) error
+	done     chan struct{}
+	report   *Report
+}
+
+// Ingest starts the replay and returns a channel containing the events to apply.
+func (f *filter) Ingest(ctx context.Context) (chan model.RatingEvent, error) {
+	in, err := f.source.Ingest(ctx)
+	if err != nil {
+		close(f.done)
+		return nil, err
+	}
+	out := make(chan model.RatingEvent, 1)
+	go func() {
+		defer close(f.done)
+		defer close(out)
+		for e := range in {
+			f.report.Read++
+			if !f.match(&e) {
+				f.report.Filtered++
+				continue
+			}
+			if err := f.validate(model.RecordId(e.RecordId), model.RecordType(e.RecordType), &e.Rating); err != nil {
+				f.report.Invalid++
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (f *filter) match(e *model.RatingEvent) bool {
+	if f.cfg.RecordType != "" && model.RecordType(e.RecordType) != f.cfg.RecordType {
+		return false
+	}
+	if len(f.cfg.RecordIds) > 0 && !slices.Contains(f.cfg.RecordIds, model.RecordId(e.RecordId)) {
+		return false
+	}
+	if len(f.cfg.Providers) > 0 && !slices.Contains(f.cfg.Providers, e.ProviderId) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"mmoviecom/rating/internal/controller/rating"
+	"mmoviecom/rating/internal/recordtype"
+	"mmoviecom/rating/internal/repository/memory"
+	"mmoviecom/rating/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally/v6"
+	"go.uber.org/zap"
+)
+
+type testIngester struct {
+	events []model.RatingEvent
+}
+
+func (i *testIngester) Ingest(_ context.Context) (chan model.RatingEvent, error) {
+	ch := make(chan model.RatingEvent, len(i.events))
+	for _, e := range i.events {
+		ch <- e
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestFilter(t *testing.T) {
+	event := func(recordId string, providerId string, value model.RatingValue) model.RatingEvent {
+		return model.RatingEvent{
+			Rating: model.Rating{
+				RecordId:   recordId,
+				RecordType: string(model.RecordTypeMovie),
+				UserId:     "user",
+				Value:      value,
+				ProviderId: providerId,
+			},
+			EventType: model.RatingEventTypePut,
+		}
+	}
+	source := &testIngester{events: []model.RatingEvent{
+		event("1", "partner", 5),
+		event("1", "native", 4),
+		event("2", "partner", 3),
+		event("1", "partner", 9),
+	}}
+	f := &filter{
+		source: source,
+		cfg: Config{
+			RecordIds: []model.RecordId{"1"},
+			Providers: []string{"partner"},
+		},
+		done:   make(chan struct{}),
+		report: &Report{Providers: map[string]int{}, Records: map[string]int{}},
+	}
+	rules, _ := recordtype.Default().Get(model.RecordTypeMovie)
+	f.validate = func(_ model.RecordId, _ model.RecordType, r *model.Rating) error {
+		return rules.Validate(model.RecordId(r.RecordId), r.Value)
+	}
+
+	ch, err := f.Ingest(context.Background())
+	assert.NoError(t, err)
+	var got []model.RatingEvent
+	for e := range ch {
+		got = append(got, e)
+	}
+	<-f.done
+	assert.Equal(t, []model.RatingEvent{source.events[0]}, got)
+	assert.Equal(t, &Report{
+		Read:      4,
+		Filtered:  2,
+		Invalid:   1,
+		Providers: map[string]int{},
+		Records:   map[string]int{},
+	}, f.report, "events are counted as applied once written")
+}
+
+// failingRepository defines a repository failing to write ratings.
+type failingRepository struct {
+	*memory.Repository
+}
+
+func (r *failingRepository) Put(_ context.Context, _ model.RecordId, _ model.RecordType, _ *model.Rating) error {
+	return errors.New("write failed")
+}
+
+func TestApplyCounter(t *testing.T) {
+	ctx := context.Background()
+	rating := &model.Rating{RecordId: "1", RecordType: string(model.RecordTypeMovie), UserId: "user", Value: 5, ProviderId: "partner"}
+	report := &Report{Providers: map[string]int{}, Records: map[string]int{}}
+
+	failing := &applyCounter{repository: &failingRepository{memory.New(zap.NewNop())}, report: report}
+	assert.Error(t, failing.Put(ctx, "1", model.RecordTypeMovie, rating))
+	assert.Equal(t, 0, report.Applied, "failed writes are not counted")
+
+	counter := &applyCounter{repository: memory.New(zap.NewNop()), report: report}
+	assert.NoError(t, counter.Put(ctx, "1", model.RecordTypeMovie, rating))
+	assert.Equal(t, &Report{
+		Applied:   1,
+		Providers: map[string]int{"partner": 1},
+		Records:   map[string]int{"movie/1": 1},
+	}, report)
+}
+
+func TestReplayOutdatedEvent(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	repo := memory.New(logger)
+	now := time.Now()
+	newer := &model.Rating{RecordId: "1", RecordType: string(model.RecordTypeMovie), UserId: "user", Value: 5, ProviderId: "partner", CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, repo.Put(ctx, "1", model.RecordTypeMovie, newer))
+
+	report := &Report{Providers: map[string]int{}, Records: map[string]int{}}
+	old := model.RatingEvent{
+		Rating: model.Rating{
+			RecordId:   "1",
+			RecordType: string(model.RecordTypeMovie),
+			UserId:     "user",
+			Value:      1,
+			ProviderId: "partner",
+			UpdatedAt:  now.Add(-time.Hour),
+		},
+		EventType: model.RatingEventTypePut,
+	}
+	ctrl := rating.New(&applyCounter{repository: repo, report: report}, &testIngester{events: []model.RatingEvent{old}}, nil, nil, recordtype.Default(), nil, logger, tally.NoopScope)
+	assert.NoError(t, ctrl.StartIngestion(ctx, 1, 1))
+
+	ratings, err := repo.Get(ctx, "1", model.RecordTypeMovie)
+	assert.NoError(t, err)
+	if assert.Len(t, ratings, 1) {
+		assert.Equal(t, model.RatingValue(5), ratings[0].Value, "old events do not overwrite newer ratings")
+		assert.True(t, ratings[0].UpdatedAt.Equal(now))
+	}
+	aggs, err := repo.ListAggregates(ctx, model.RecordTypeMovie, []model.RecordId{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RecordAggregate{{RecordId: "1", Rating: 5, Count: 1}}, aggs)
+	assert.Equal(t, &Report{Outdated: 1, Providers: map[string]int{}, Records: map[string]int{}}, report)
+}
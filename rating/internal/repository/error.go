@@ -4,3 +4,6 @@ import "errors"
 
 // ErrNotFound is returned when requested record is not found.
 var ErrNotFound = errors.New("not found")
+
+// ErrOutdated is returned when a rating is older than the stored rating of the user.
+var ErrOutdated = errors.New("rating is outdated")
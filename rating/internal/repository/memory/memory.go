@@ -5,6 +5,10 @@ import (
 	"mmoviecom/pkg/logging"
 	"mmoviecom/rating/internal/repository"
 	"mmoviecom/rating/pkg/model"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
@@ -14,8 +18,16 @@ const tracerID = "rating-repository-memory"
 
 // Repository defines a rating repository.
 type Repository struct {
-	data   map[model.RecordType]map[model.RecordId][]model.Rating
-	logger *zap.Logger
+	sync.RWMutex
+	data       map[model.RecordType]map[model.RecordId][]model.Rating
+	aggregates map[model.RecordType]map[model.RecordId]*aggregate
+	logger     *zap.Logger
+}
+
+// aggregate defines a running sum and count of record ratings.
+type aggregate struct {
+	sum   int
+	count int
 }
 
 // New creates a new memory repository.
@@ -24,13 +36,19 @@ func New(logger *zap.Logger) *Repository {
 		zap.String(logging.FieldComponent, "repository"),
 		zap.String(logging.FieldType, "memory"),
 	)
-	return &Repository{data: map[model.RecordType]map[model.RecordId][]model.Rating{}, logger: logger}
+	return &Repository{
+		data:       map[model.RecordType]map[model.RecordId][]model.Rating{},
+		aggregates: map[model.RecordType]map[model.RecordId]*aggregate{},
+		logger:     logger,
+	}
 }
 
 // Get retrieves all ratings for a given record.
 func (r *Repository) Get(ctx context.Context, recordId model.RecordId, recordType model.RecordType) ([]model.Rating, error) {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Get")
 	defer span.End()
+	r.RLock()
+	defer r.RUnlock()
 	if _, ok := r.data[recordType]; !ok {
 		return nil, repository.ErrNotFound
 	}
@@ -40,13 +58,201 @@ func (r *Repository) Get(ctx context.Context, recordId model.RecordId, recordTyp
 	return r.data[recordType][recordId], nil
 }
 
-// Put adds a rating for a given record.
+// Put adds a rating for a given record or updates the existing rating of the user.
+// A rating without a review keeps the existing review and its moderation status.
+// A rating older than the existing one is not written and ErrOutdated is returned.
 func (r *Repository) Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating) error {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Put")
 	defer span.End()
+	r.Lock()
+	defer r.Unlock()
 	if _, ok := r.data[recordType]; !ok {
 		r.data[recordType] = map[model.RecordId][]model.Rating{}
+		r.aggregates[recordType] = map[model.RecordId]*aggregate{}
+	}
+	if _, ok := r.aggregates[recordType][recordId]; !ok {
+		r.aggregates[recordType][recordId] = &aggregate{}
+	}
+	agg := r.aggregates[recordType][recordId]
+	ratings := r.data[recordType][recordId]
+	for i := range ratings {
+		if ratings[i].UserId == rating.UserId {
+			if rating.UpdatedAt.Before(ratings[i].UpdatedAt) {
+				return repository.ErrOutdated
+			}
+			// Copy on write, Get callers may still hold the old slice.
+			updated := append([]model.Rating{}, ratings...)
+			updated[i] = *rating
+			updated[i].CreatedAt = ratings[i].CreatedAt
+			if rating.Review == "" {
+				updated[i].Review, updated[i].ReviewStatus = ratings[i].Review, ratings[i].ReviewStatus
+			}
+			r.data[recordType][recordId] = updated
+			agg.sum += int(rating.Value - ratings[i].Value)
+			return nil
+		}
 	}
-	r.data[recordType][recordId] = append(r.data[recordType][recordId], *rating)
+	r.data[recordType][recordId] = append(ratings, *rating)
+	agg.sum += int(rating.Value)
+	agg.count++
 	return nil
 }
+
+// ListTopRated retrieves aggregated ratings of a given record type with at least
+// minVotes ratings, ordered by the aggregated rating.
+func (r *Repository) ListTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, limit int) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListTopRated")
+	defer span.End()
+	r.RLock()
+	var res []model.RecordAggregate
+	for recordId, agg := range r.aggregates[recordType] {
+		if agg.count == 0 || agg.count < minVotes {
+			continue
+		}
+		res = append(res, model.RecordAggregate{
+			RecordId: recordId,
+			Rating:   float64(agg.sum) / float64(agg.count),
+			Count:    agg.count,
+		})
+	}
+	r.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rating != res[j].Rating {
+			return res[i].Rating > res[j].Rating
+		}
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].RecordId < res[j].RecordId
+	})
+	if offset >= len(res) {
+		return nil, nil
+	}
+	return res[offset:min(offset+limit, len(res))], nil
+}
+
+// ListAggregates retrieves the aggregated ratings of the given records
+// of a record type. Records without ratings are omitted.
+func (r *Repository) ListAggregates(ctx context.Context, recordType model.RecordType, recordIds []model.RecordId) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListAggregates")
+	defer span.End()
+	r.RLock()
+	defer r.RUnlock()
+	var res []model.RecordAggregate
+	for _, recordId := range recordIds {
+		agg, ok := r.aggregates[recordType][recordId]
+		if !ok || agg.count == 0 {
+			continue
+		}
+		res = append(res, model.RecordAggregate{
+			RecordId: recordId,
+			Rating:   float64(agg.sum) / float64(agg.count),
+			Count:    agg.count,
+		})
+	}
+	return res, nil
+}
+
+// Aggregate retrieves the aggregated rating of a given record over ratings
+// updated since a given time. If providers are given, only ratings of these
+// providers are aggregated.
+func (r *Repository) Aggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType, since time.Time, providers []string) (*model.AggregatedRating, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Aggregate")
+	defer span.End()
+	r.RLock()
+	defer r.RUnlock()
+	sum := 0
+	res := &model.AggregatedRating{ProviderCounts: map[string]int{}}
+	for _, rating := range r.data[recordType][recordId] {
+		if rating.UpdatedAt.Before(since) {
+			continue
+		}
+		if len(providers) > 0 && !slices.Contains(providers, rating.ProviderId) {
+			continue
+		}
+		sum += int(rating.Value)
+		res.Count++
+		res.ProviderCounts[rating.ProviderId]++
+	}
+	if res.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+	res.Rating = float64(sum) / float64(res.Count)
+	return res, nil
+}
+
+// ListTrending retrieves aggregated ratings of records of a given type over
+// ratings updated since a given time, ordered by the number of these ratings.
+func (r *Repository) ListTrending(ctx context.Context, recordType model.RecordType, since time.Time, limit int) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListTrending")
+	defer span.End()
+	r.RLock()
+	var res []model.RecordAggregate
+	for recordId, ratings := range r.data[recordType] {
+		sum, count := 0, 0
+		for _, rating := range ratings {
+			if !rating.UpdatedAt.Before(since) {
+				sum += int(rating.Value)
+				count++
+			}
+		}
+		if count > 0 {
+			res = append(res, model.RecordAggregate{RecordId: recordId, Rating: float64(sum) / float64(count), Count: count})
+		}
+	}
+	r.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		if res[i].Rating != res[j].Rating {
+			return res[i].Rating > res[j].Rating
+		}
+		return res[i].RecordId < res[j].RecordId
+	})
+	return res[:min(limit, len(res))], nil
+}
+
+// ListReviews retrieves ratings of a given record with a review in a given
+// moderation status, most recently updated first.
+func (r *Repository) ListReviews(ctx context.Context, recordId model.RecordId, recordType model.RecordType, status model.ReviewStatus, offset int, limit int) ([]model.Rating, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListReviews")
+	defer span.End()
+	r.RLock()
+	var res []model.Rating
+	for _, rating := range r.data[recordType][recordId] {
+		if rating.Review != "" && rating.ReviewStatus == status {
+			rating.RecordId = string(recordId)
+			res = append(res, rating)
+		}
+	}
+	r.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].UpdatedAt.Equal(res[j].UpdatedAt) {
+			return res[i].UpdatedAt.After(res[j].UpdatedAt)
+		}
+		return res[i].UserId < res[j].UserId
+	})
+	if offset >= len(res) {
+		return nil, nil
+	}
+	return res[offset:min(offset+limit, len(res))], nil
+}
+
+// SetReviewStatus updates the moderation status of a user review of a given record.
+func (r *Repository) SetReviewStatus(ctx context.Context, recordId model.RecordId, recordType model.RecordType, userId model.UserId, status model.ReviewStatus) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/SetReviewStatus")
+	defer span.End()
+	r.Lock()
+	defer r.Unlock()
+	ratings := r.data[recordType][recordId]
+	for i := range ratings {
+		if ratings[i].UserId == userId && ratings[i].Review != "" {
+			updated := append([]model.Rating{}, ratings...)
+			updated[i].ReviewStatus = status
+			r.data[recordType][recordId] = updated
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"mmoviecom/pkg/logging"
 	"mmoviecom/rating/configs"
+	"mmoviecom/rating/internal/repository"
 	"mmoviecom/rating/pkg/model"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"go.opentelemetry.io/otel"
@@ -29,7 +32,7 @@ func New(config configs.MysqlConfig, logger *zap.Logger) (*Repository, error) {
 		zap.String(logging.FieldType, "mysql"),
 	)
 	logger.Info("Connecting to mysql")
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", config.User, config.Pass, config.Host, config.Port, config.Name))
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&clientFoundRows=true", config.User, config.Pass, config.Host, config.Port, config.Name))
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +44,7 @@ func (r *Repository) Get(ctx context.Context, recordId model.RecordId, recordTyp
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Get")
 	defer span.End()
 	r.logger.Info("Trying to get rating from MySQL", zap.String("record", fmt.Sprintf("%v/%v", recordType, recordId)))
-	rows, err := r.db.QueryContext(ctx, "SELECT user_id, value FROM ratings WHERE record_id = ? AND record_type = ?", recordId, recordType)
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id, value, provider_id, COALESCE(review, ''), COALESCE(review_status, ''), created_at, updated_at FROM ratings WHERE record_id = ? AND record_type = ?", recordId, recordType)
 	if err != nil {
 		r.logger.Warn("Failed to get rating from MySQL", zap.String("record", fmt.Sprintf("%v/%v", recordType, recordId)), zap.Error(err))
 		return nil, err
@@ -49,28 +52,256 @@ func (r *Repository) Get(ctx context.Context, recordId model.RecordId, recordTyp
 	defer rows.Close()
 	var res []model.Rating
 	for rows.Next() {
-		var userID string
+		var userID, providerID, review, reviewStatus string
 		var value int32
-		if err := rows.Scan(&userID, &value); err != nil {
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&userID, &value, &providerID, &review, &reviewStatus, &createdAt, &updatedAt); err != nil {
 			r.logger.Warn("Failed to get rating items from MySQL", zap.String("record", fmt.Sprintf("%v/%v", recordType, recordId)), zap.Error(err))
 			return nil, err
 		}
 		res = append(res, model.Rating{
-			UserId: model.UserId(userID),
-			Value:  model.RatingValue(value),
+			RecordId:     string(recordId),
+			RecordType:   string(recordType),
+			UserId:       model.UserId(userID),
+			Value:        model.RatingValue(value),
+			ProviderId:   providerID,
+			Review:       review,
+			ReviewStatus: model.ReviewStatus(reviewStatus),
+			CreatedAt:    createdAt,
+			UpdatedAt:    updatedAt,
 		})
 	}
-	return res, nil
+	return res, rows.Err()
 }
 
-// Put adds a rating for a given record.
+// Put adds a rating for a given record or updates the existing rating of the user.
+// A rating without a review keeps the existing review and its moderation status.
+// A rating older than the existing one is not written and ErrOutdated is returned.
 func (r *Repository) Put(ctx context.Context, recordId model.RecordId, recordType model.RecordType, rating *model.Rating) error {
 	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Put")
 	defer span.End()
 	if rating == nil {
 		return errors.New("rating is nil")
 	}
-	_, err := r.db.ExecContext(ctx, "INSERT INTO ratings (record_id, record_type, user_id, value) VALUES (?, ?, ?, ?)",
-		recordId, recordType, rating.UserId, rating.Value)
-	return err
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			r.logger.Warn("Failed to rollback transaction", zap.Error(err))
+		}
+	}()
+	var previous int32
+	var previousUpdatedAt time.Time
+	sumDelta, countDelta := int32(rating.Value), 1
+	err = tx.QueryRowContext(ctx, "SELECT value, updated_at FROM ratings WHERE record_id = ? AND record_type = ? AND user_id = ? FOR UPDATE",
+		recordId, recordType, rating.UserId).Scan(&previous, &previousUpdatedAt)
+	if err == nil {
+		if rating.UpdatedAt.Before(previousUpdatedAt) {
+			return repository.ErrOutdated
+		}
+		sumDelta, countDelta = int32(rating.Value)-previous, 0
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO ratings (record_id, record_type, user_id, value, provider_id, review, review_status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), provider_id = VALUES(provider_id),
+			review_status = IF(VALUES(review) = '', review_status, VALUES(review_status)),
+			review = IF(VALUES(review) = '', review, VALUES(review)),
+			updated_at = VALUES(updated_at)`,
+		recordId, recordType, rating.UserId, rating.Value, rating.ProviderId, rating.Review, rating.ReviewStatus, rating.CreatedAt, rating.UpdatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO rating_aggregates (record_id, record_type, rating_sum, rating_count) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rating_sum = rating_sum + VALUES(rating_sum), rating_count = rating_count + VALUES(rating_count)`,
+		recordId, recordType, sumDelta, countDelta); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListTopRated retrieves aggregated ratings of a given record type with at least
+// minVotes ratings, ordered by the aggregated rating.
+func (r *Repository) ListTopRated(ctx context.Context, recordType model.RecordType, minVotes int, offset int, limit int) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListTopRated")
+	defer span.End()
+	rows, err := r.db.QueryContext(ctx, `SELECT record_id, rating_avg, rating_count FROM rating_aggregates
+		WHERE record_type = ? AND rating_count > 0 AND rating_count >= ?
+		ORDER BY rating_avg DESC, rating_count DESC, record_id LIMIT ? OFFSET ?`,
+		recordType, minVotes, limit, offset)
+	if err != nil {
+		r.logger.Warn("Failed to list top rated records from MySQL", zap.String("recordType", string(recordType)), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.RecordAggregate
+	for rows.Next() {
+		var recordID string
+		var avg float64
+		var count int
+		if err := rows.Scan(&recordID, &avg, &count); err != nil {
+			return nil, err
+		}
+		res = append(res, model.RecordAggregate{RecordId: model.RecordId(recordID), Rating: avg, Count: count})
+	}
+	return res, rows.Err()
+}
+
+// ListAggregates retrieves the aggregated ratings of the given records
+// of a record type. Records without ratings are omitted.
+func (r *Repository) ListAggregates(ctx context.Context, recordType model.RecordType, recordIds []model.RecordId) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListAggregates")
+	defer span.End()
+	if len(recordIds) == 0 {
+		return nil, nil
+	}
+	args := []any{recordType}
+	for _, id := range recordIds {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(recordIds)), ",")
+	rows, err := r.db.QueryContext(ctx, `SELECT record_id, rating_avg, rating_count FROM rating_aggregates
+		WHERE record_type = ? AND rating_count > 0 AND record_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		r.logger.Warn("Failed to list aggregated ratings from MySQL", zap.String("recordType", string(recordType)), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.RecordAggregate
+	for rows.Next() {
+		var recordID string
+		var avg float64
+		var count int
+		if err := rows.Scan(&recordID, &avg, &count); err != nil {
+			return nil, err
+		}
+		res = append(res, model.RecordAggregate{RecordId: model.RecordId(recordID), Rating: avg, Count: count})
+	}
+	return res, rows.Err()
+}
+
+// Aggregate retrieves the aggregated rating of a given record over ratings
+// updated since a given time. If providers are given, only ratings of these
+// providers are aggregated.
+func (r *Repository) Aggregate(ctx context.Context, recordId model.RecordId, recordType model.RecordType, since time.Time, providers []string) (*model.AggregatedRating, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/Aggregate")
+	defer span.End()
+	query := "SELECT provider_id, SUM(value), COUNT(*) FROM ratings WHERE record_id = ? AND record_type = ? AND updated_at >= ?"
+	args := []any{recordId, recordType, since}
+	if len(providers) > 0 {
+		query += " AND provider_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(providers)), ",") + ")"
+		for _, p := range providers {
+			args = append(args, p)
+		}
+	}
+	rows, err := r.db.QueryContext(ctx, query+" GROUP BY provider_id", args...)
+	if err != nil {
+		r.logger.Warn("Failed to aggregate ratings in MySQL", zap.String("record", fmt.Sprintf("%v/%v", recordType, recordId)), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	sum := int64(0)
+	res := &model.AggregatedRating{ProviderCounts: map[string]int{}}
+	for rows.Next() {
+		var providerID string
+		var providerSum int64
+		var count int
+		if err := rows.Scan(&providerID, &providerSum, &count); err != nil {
+			return nil, err
+		}
+		sum += providerSum
+		res.Count += count
+		res.ProviderCounts[providerID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if res.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+	res.Rating = float64(sum) / float64(res.Count)
+	return res, nil
+}
+
+// ListTrending retrieves aggregated ratings of records of a given type over
+// ratings updated since a given time, ordered by the number of these ratings.
+func (r *Repository) ListTrending(ctx context.Context, recordType model.RecordType, since time.Time, limit int) ([]model.RecordAggregate, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListTrending")
+	defer span.End()
+	rows, err := r.db.QueryContext(ctx, `SELECT record_id, SUM(value) / COUNT(*) AS rating_avg, COUNT(*) AS rating_count FROM ratings
+		WHERE record_type = ? AND updated_at >= ?
+		GROUP BY record_id ORDER BY rating_count DESC, rating_avg DESC, record_id LIMIT ?`,
+		recordType, since, limit)
+	if err != nil {
+		r.logger.Warn("Failed to list trending records from MySQL", zap.String("recordType", string(recordType)), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.RecordAggregate
+	for rows.Next() {
+		var recordID string
+		var avg float64
+		var count int
+		if err := rows.Scan(&recordID, &avg, &count); err != nil {
+			return nil, err
+		}
+		res = append(res, model.RecordAggregate{RecordId: model.RecordId(recordID), Rating: avg, Count: count})
+	}
+	return res, rows.Err()
+}
+
+// ListReviews retrieves ratings of a given record with a review in a given
+// moderation status, most recently updated first.
+func (r *Repository) ListReviews(ctx context.Context, recordId model.RecordId, recordType model.RecordType, status model.ReviewStatus, offset int, limit int) ([]model.Rating, error) {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/ListReviews")
+	defer span.End()
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id, value, provider_id, review, created_at, updated_at FROM ratings
+		WHERE record_id = ? AND record_type = ? AND review_status = ? AND review <> ''
+		ORDER BY updated_at DESC, user_id LIMIT ? OFFSET ?`,
+		recordId, recordType, status, limit, offset)
+	if err != nil {
+		r.logger.Warn("Failed to list reviews from MySQL", zap.String("record", fmt.Sprintf("%v/%v", recordType, recordId)), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var res []model.Rating
+	for rows.Next() {
+		var userID, providerID, review string
+		var value int32
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&userID, &value, &providerID, &review, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, model.Rating{
+			RecordId:     string(recordId),
+			RecordType:   string(recordType),
+			UserId:       model.UserId(userID),
+			Value:        model.RatingValue(value),
+			ProviderId:   providerID,
+			Review:       review,
+			ReviewStatus: status,
+			CreatedAt:    createdAt,
+			UpdatedAt:    updatedAt,
+		})
+	}
+	return res, rows.Err()
+}
+
+// SetReviewStatus updates the moderation status of a user review of a given record.
+func (r *Repository) SetReviewStatus(ctx context.Context, recordId model.RecordId, recordType model.RecordType, userId model.UserId, status model.ReviewStatus) error {
+	_, span := otel.Tracer(tracerID).Start(ctx, "Repository/SetReviewStatus")
+	defer span.End()
+	res, err := r.db.ExecContext(ctx, "UPDATE ratings SET review_status = ? WHERE record_id = ? AND record_type = ? AND user_id = ? AND review <> ''",
+		status, recordId, recordType, userId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
 }
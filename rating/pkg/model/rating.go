@@ -1,6 +1,10 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"mmoviecom/gen"
+	"time"
+)
 
 // RecordId defines a record id. Together with RecordType
 // identifies unique record across all types.
@@ -12,7 +16,9 @@ type RecordType string
 
 // Existing record types.
 const (
-	RecordTypeMovie = RecordType("movie")
+	RecordTypeMovie   = RecordType("movie")
+	RecordTypeSeries  = RecordType("series")
+	RecordTypeEpisode = RecordType("episode")
 )
 
 // UserId defines a user id.
@@ -21,27 +27,103 @@ type UserId string
 // RatingValue defines a value of a rating record.
 type RatingValue int
 
-// Rating defines an individual rating created by a user for some record.
+// NativeProviderId defines the provider of ratings created by users of the service itself.
+const NativeProviderId = "native"
+
+// Rating defines an individual rating created by a user for some record,
+// optionally explained by a review text. The allowed value range depends
+// on the record type. ProviderId tells where the rating comes from,
+// NativeProviderId or a partner the rating was imported from, and is
+// required so that imported ratings are never taken for native ones.
 type Rating struct {
-	RecordId   string      `json:"recordId" validate:"required"`
-	RecordType string      `json:"recordType" validate:"required"`
-	UserId     UserId      `json:"userId" validate:"required"`
-	Value      RatingValue `json:"value" validate:"gte=1,lte=5"`
+	RecordId     string       `json:"recordId" validate:"required"`
+	RecordType   string       `json:"recordType" validate:"required"`
+	UserId       UserId       `json:"userId" validate:"required"`
+	Value        RatingValue  `json:"value"`
+	ProviderId   string       `json:"providerId" validate:"required"`
+	Review       string       `json:"review,omitempty" validate:"max=4000"`
+	ReviewStatus ReviewStatus `json:"reviewStatus,omitempty"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+// ReviewStatus defines the moderation state of a review.
+type ReviewStatus string
+
+// Review moderation states.
+const (
+	ReviewStatusPending  = ReviewStatus("pending")
+	ReviewStatusApproved = ReviewStatus("approved")
+	ReviewStatusRejected = ReviewStatus("rejected")
+)
+
+// ReviewToProto converts a reviewed Rating struct into a
+// generated proto counterpart.
+func ReviewToProto(r *Rating) *gen.Review {
+	return &gen.Review{
+		UserId:      string(r.UserId),
+		RecordId:    r.RecordId,
+		RecordType:  r.RecordType,
+		RatingValue: int32(r.Value),
+		Text:        r.Review,
+		Status:      string(r.ReviewStatus),
+		UpdatedAt:   r.UpdatedAt.Unix(),
+	}
 }
 
 func (r *Rating) String() string {
-	return fmt.Sprintf("Rating{recordId=%s, recordType=%s, UserId=%s, Value=%d}", r.RecordId, r.RecordType, r.UserId, r.Value)
+	return fmt.Sprintf("Rating{recordId=%s, recordType=%s, UserId=%s, Value=%d, ProviderId=%s}", r.RecordId, r.RecordType, r.UserId, r.Value, r.ProviderId)
 }
 
+// RatingEventSchemaVersion is the rating event schema version produced
+// by this code. Events without a version are treated as version 1.
+const RatingEventSchemaVersion = 1
+
+// Rating event content types, passed in the ContentTypeHeader message header.
+const (
+	ContentTypeHeader   = "content-type"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
 // RatingEvent defines an event containing rating information.
 type RatingEvent struct {
 	Rating
-	ProviderId string          `json:"providerId" validate:"required"`
-	EventType  RatingEventType `json:"eventType" validate:"required"`
+	SchemaVersion int             `json:"schemaVersion,omitempty"`
+	EventType     RatingEventType `json:"eventType" validate:"required"`
 }
 
 func (ev *RatingEvent) String() string {
-	return fmt.Sprintf("RatingEvent{Rating=%s, ProviderId=%s, EventType=%s}", ev.Rating.String(), ev.ProviderId, ev.EventType)
+	return fmt.Sprintf("RatingEvent{Rating=%s, SchemaVersion=%d, EventType=%s}", ev.Rating.String(), ev.SchemaVersion, ev.EventType)
+}
+
+// RatingEventToProto converts a RatingEvent struct into a
+// generated proto counterpart.
+func RatingEventToProto(ev *RatingEvent) *gen.RatingEvent {
+	return &gen.RatingEvent{
+		SchemaVersion: int32(ev.SchemaVersion),
+		UserId:        string(ev.UserId),
+		RecordId:      ev.RecordId,
+		RecordType:    ev.RecordType,
+		RatingValue:   int32(ev.Value),
+		ProviderId:    ev.ProviderId,
+		EventType:     string(ev.EventType),
+	}
+}
+
+// RatingEventFromProto converts a generated proto counterpart into a RatingEvent struct.
+func RatingEventFromProto(ev *gen.RatingEvent) *RatingEvent {
+	return &RatingEvent{
+		Rating: Rating{
+			RecordId:   ev.RecordId,
+			RecordType: ev.RecordType,
+			UserId:     UserId(ev.UserId),
+			Value:      RatingValue(ev.RatingValue),
+			ProviderId: ev.ProviderId,
+		},
+		SchemaVersion: int(ev.SchemaVersion),
+		EventType:     RatingEventType(ev.EventType),
+	}
 }
 
 // RatingEventType defines the type of rating event.
@@ -52,3 +134,75 @@ const (
 	RatingEventTypePut    = RatingEventType("put")
 	RatingEventTypeDelete = RatingEventType("delete")
 )
+
+// TrendingRecord defines a record ranked by its rating velocity over a time window.
+type TrendingRecord struct {
+	RecordId RecordId
+	Velocity float64
+	Rating   float64
+	Count    int
+}
+
+// TrendingRecordToProto converts a TrendingRecord struct into a
+// generated proto counterpart.
+func TrendingRecordToProto(r *TrendingRecord) *gen.TrendingRecord {
+	return &gen.TrendingRecord{
+		RecordId:    string(r.RecordId),
+		Velocity:    r.Velocity,
+		RatingValue: r.Rating,
+		Count:       int32(r.Count),
+	}
+}
+
+// RecordAggregate defines the aggregated rating of a record.
+type RecordAggregate struct {
+	RecordId RecordId
+	Rating   float64
+	Count    int
+}
+
+// RecordAggregateToProto converts a RecordAggregate struct into a
+// generated proto counterpart.
+func RecordAggregateToProto(a *RecordAggregate) *gen.TopRatedRecord {
+	return &gen.TopRatedRecord{
+		RecordId:    string(a.RecordId),
+		RatingValue: a.Rating,
+		Count:       int32(a.Count),
+	}
+}
+
+// AggregatedRating defines the aggregated rating of a record
+// along with the number of ratings of every provider.
+type AggregatedRating struct {
+	Rating         float64
+	Count          int
+	ProviderCounts map[string]int
+}
+
+// AggregatedRatingToProto converts an AggregatedRating struct into a
+// generated proto counterpart.
+func AggregatedRatingToProto(r *AggregatedRating) *gen.GetAggregatedRatingResponse {
+	counts := make(map[string]int32, len(r.ProviderCounts))
+	for provider, count := range r.ProviderCounts {
+		counts[provider] = int32(count)
+	}
+	return &gen.GetAggregatedRatingResponse{
+		RatingValue:    r.Rating,
+		Count:          int32(r.Count),
+		ProviderCounts: counts,
+	}
+}
+
+// AggregatedRatingChangedEvent defines an event published when
+// the aggregated rating of a record changes.
+type AggregatedRatingChangedEvent struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	RecordId      RecordId   `json:"recordId"`
+	RecordType    RecordType `json:"recordType"`
+	Rating        float64    `json:"rating"`
+	Count         int        `json:"count"`
+}
+
+func (ev *AggregatedRatingChangedEvent) String() string {
+	return fmt.Sprintf("AggregatedRatingChangedEvent{SchemaVersion=%d, RecordId=%s, RecordType=%s, Rating=%f, Count=%d}", ev.SchemaVersion, ev.RecordId, ev.RecordType, ev.Rating, ev.Count)
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	gen "mmoviecom/gen"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtobufConversion(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{
+			name: "RatingEvent conversion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := RatingEvent{
+				Rating: Rating{
+					RecordId:   "id",
+					RecordType: "movie",
+					UserId:     "user",
+					Value:      5,
+					ProviderId: "provider",
+				},
+				SchemaVersion: RatingEventSchemaVersion,
+				EventType:     RatingEventTypePut,
+			}
+			genModel := gen.RatingEvent{
+				SchemaVersion: RatingEventSchemaVersion,
+				UserId:        "user",
+				RecordId:      "id",
+				RecordType:    "movie",
+				RatingValue:   5,
+				ProviderId:    "provider",
+				EventType:     "put",
+			}
+
+			m2p := RatingEventToProto(&model)
+			p2m := RatingEventFromProto(&genModel)
+			m2pDiff := cmp.Diff(m2p, &genModel, cmpopts.IgnoreUnexported(gen.RatingEvent{}))
+			assert.Equal(t, "", m2pDiff, tt.name)
+			p2mDiff := cmp.Diff(p2m, &model)
+			assert.Equal(t, "", p2mDiff, tt.name)
+		})
+	}
+}
@@ -2,12 +2,16 @@ package testutil
 
 import (
 	"mmoviecom/gen"
+	"mmoviecom/internal/grpcutil"
+	"mmoviecom/pkg/breaker"
 	"mmoviecom/pkg/discovery"
 	"mmoviecom/pkg/logging"
+	"mmoviecom/pkg/retry"
 	"mmoviecom/rating/internal/controller/rating"
 	authgateway "mmoviecom/rating/internal/gateway/auth/grpc"
 	"mmoviecom/rating/internal/handler/grpc"
 	"mmoviecom/rating/internal/ingester/kafka"
+	"mmoviecom/rating/internal/recordtype"
 	"mmoviecom/rating/internal/repository/memory"
 
 	"github.com/uber-go/tally/v6"
@@ -21,12 +25,16 @@ func NewTestRatingGRPCServer(registry discovery.Registry, logger *zap.Logger, sc
 	)
 	r := memory.New(logger)
 
-	ingester, err := kafka.NewIngester("localhost", "rating", "ratings", logger)
+	ingester, err := kafka.NewIngester("localhost", "rating", "ratings", logger, scope)
 	if err != nil {
 		logger.Fatal("Failed to initialize ingester", zap.Error(err))
 	}
 
-	auth := authgateway.New(registry, insecure.NewCredentials(), logger)
-	ctrl := rating.New(r, ingester, auth, logger)
+	pool, err := grpcutil.NewConnPool(registry, insecure.NewCredentials(), nil)
+	if err != nil {
+		logger.Fatal("Failed to create gRPC connection pool", zap.Error(err))
+	}
+	auth := authgateway.New(pool, breaker.New("auth", breaker.Config{}, logger, scope), retry.New("auth", retry.Config{}, logger, scope), logger)
+	ctrl := rating.New(r, ingester, nil, auth, recordtype.Default(), []string{"admin"}, logger, scope)
 	return grpc.New(ctrl, logger, scope)
 }
@@ -1,3 +1,7 @@
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version VARCHAR(255) PRIMARY KEY,
+    applied_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+);
 CREATE TABLE IF NOT EXISTS movies (
     id VARCHAR(255) PRIMARY KEY,
     title VARCHAR(255),
@@ -10,4 +14,5 @@ CREATE TABLE IF NOT EXISTS ratings(
     user_id VARCHAR(255),
     value INT,
     PRIMARY KEY (record_id, record_type, user_id)
-);
\ No newline at end of file
+);
+INSERT INTO schema_migrations (version) VALUES ('0001_init');
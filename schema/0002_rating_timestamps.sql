@@ -0,0 +1,5 @@
+ALTER TABLE ratings
+    ADD COLUMN created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    ADD COLUMN updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    ADD INDEX ratings_record_type_updated_at (record_type, updated_at);
+INSERT INTO schema_migrations (version) VALUES ('0002_rating_timestamps');
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS rating_aggregates(
+    record_id VARCHAR(255),
+    record_type VARCHAR(255),
+    rating_sum BIGINT NOT NULL DEFAULT 0,
+    rating_count INT NOT NULL DEFAULT 0,
+    rating_avg DOUBLE AS (IF(rating_count = 0, 0, rating_sum / rating_count)) STORED,
+    PRIMARY KEY (record_id, record_type),
+    INDEX rating_aggregates_top (record_type, rating_avg, rating_count)
+);
+INSERT INTO rating_aggregates (record_id, record_type, rating_sum, rating_count)
+    SELECT record_id, record_type, SUM(value), COUNT(*) FROM ratings GROUP BY record_id, record_type
+    ON DUPLICATE KEY UPDATE rating_sum = VALUES(rating_sum), rating_count = VALUES(rating_count);
+INSERT INTO schema_migrations (version) VALUES ('0003_rating_aggregates');
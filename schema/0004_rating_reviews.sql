@@ -0,0 +1,5 @@
+ALTER TABLE ratings
+    ADD COLUMN review TEXT,
+    ADD COLUMN review_status VARCHAR(16),
+    ADD INDEX ratings_reviews (record_id, record_type, review_status, updated_at);
+INSERT INTO schema_migrations (version) VALUES ('0004_rating_reviews');
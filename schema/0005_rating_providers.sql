@@ -0,0 +1,4 @@
+-- Ratings stored before providers were tracked are native, new ratings must name their provider.
+ALTER TABLE ratings ADD COLUMN provider_id VARCHAR(255) NOT NULL DEFAULT 'native';
+ALTER TABLE ratings ALTER COLUMN provider_id DROP DEFAULT;
+INSERT INTO schema_migrations (version) VALUES ('0005_rating_providers');
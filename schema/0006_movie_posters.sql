@@ -0,0 +1,2 @@
+ALTER TABLE movies ADD COLUMN poster VARCHAR(255) NOT NULL DEFAULT '';
+INSERT INTO schema_migrations (version) VALUES ('0006_movie_posters');
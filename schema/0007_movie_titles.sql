@@ -0,0 +1,2 @@
+CREATE INDEX movies_title ON movies (title, id);
+INSERT INTO schema_migrations (version) VALUES ('0007_movie_titles');
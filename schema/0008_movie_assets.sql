@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS movie_assets (
+    movie_id VARCHAR(255),
+    kind VARCHAR(16),
+    filename VARCHAR(255),
+    size BIGINT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    sha256 CHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (movie_id, kind, filename)
+);
+INSERT INTO schema_migrations (version) VALUES ('0008_movie_assets');
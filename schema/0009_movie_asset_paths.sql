@@ -0,0 +1,3 @@
+-- Assets linked before paths were stored keep an empty path.
+ALTER TABLE movie_assets ADD COLUMN path VARCHAR(1024) NOT NULL DEFAULT '';
+INSERT INTO schema_migrations (version) VALUES ('0009_movie_asset_paths');
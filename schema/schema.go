@@ -0,0 +1,117 @@
+// Package schema provides the MySQL schema migrations of the services.
+//
+// Migrations are applied in the order of their versions, the file names
+// without the extension. Every migration records its version in the
+// schema_migrations table, so it is applied once, both when the MySQL
+// container initializes a new database and when Apply upgrades an
+// existing one.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// createMigrationsTable creates the table of applied migration versions.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version VARCHAR(255) PRIMARY KEY,
+    applied_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+)`
+
+// statementEnd matches a semicolon ending a statement line.
+var statementEnd = regexp.MustCompile(`;[ \t]*(\r?\n|$)`)
+
+// Migration defines a schema migration.
+type Migration struct {
+	Version    string
+	Statements []string
+}
+
+// Migrations returns the schema migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	var res []Migration
+	for _, e := range entries {
+		b, err := files.ReadFile(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Migration{
+			Version:    strings.TrimSuffix(e.Name(), path.Ext(e.Name())),
+			Statements: statements(string(b)),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	return res, nil
+}
+
+// statements splits SQL into statements ending with a semicolon at the end of a line.
+func statements(sql string) []string {
+	var res []string
+	for _, s := range statementEnd.Split(sql, -1) {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Apply applies the migrations not recorded in the schema_migrations table
+// and returns their versions. A failed migration stops the upgrade, its
+// statements are not rolled back, as MySQL commits schema changes implicitly.
+func Apply(ctx context.Context, db *sql.DB) ([]string, error) {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		for _, s := range m.Statements {
+			if _, err := db.ExecContext(ctx, s); err != nil {
+				return res, err
+			}
+		}
+		res = append(res, m.Version)
+	}
+	return res, nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[string]bool{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		res[v] = true
+	}
+	return res, rows.Err()
+}
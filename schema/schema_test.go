@@ -0,0 +1,36 @@
+package schema
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	if !assert.NotEmpty(t, migrations) {
+		return
+	}
+	assert.Equal(t, "0001_init", migrations[0].Version)
+	for i, m := range migrations {
+		if i > 0 {
+			assert.Less(t, migrations[i-1].Version, m.Version, "migrations are ordered by version")
+		}
+		if assert.NotEmpty(t, m.Statements, m.Version) {
+			last := m.Statements[len(m.Statements)-1]
+			want := fmt.Sprintf("INSERT INTO schema_migrations (version) VALUES ('%s')", m.Version)
+			assert.Equal(t, want, last, "a migration must record its version last")
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := "CREATE TABLE a (\n    id INT\n);\nINSERT INTO a VALUES (1);  \n\nSELECT 'a;b' FROM a;"
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id INT\n)",
+		"INSERT INTO a VALUES (1)",
+		"SELECT 'a;b' FROM a",
+	}, statements(sql))
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	authtest "mmoviecom/auth/pkg/testutil"
 	"mmoviecom/gen"
 	metadatatest "mmoviecom/metadata/pkg/testutil"
@@ -18,7 +21,9 @@ import (
 	"github.com/uber-go/tally/v6"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -172,14 +177,25 @@ func main() {
 		log.Fatal("rating mismatch", zap.Float64("got", got), zap.Float64("want", want))
 	}
 
+	const secondUserID = "user1"
+	log.Info("Getting token of the second user via auth service")
+	getTokenResp, err = authClient.GetToken(ctx, &gen.GetTokenRequest{
+		Username: secondUserID,
+		Password: "password",
+	})
+	if err != nil {
+		log.Fatal("get token", zap.Error(err))
+	}
+	secondToken := getTokenResp.GetToken()
+
 	log.Info("Saving second rating via rating service")
 	secondRating := int32(1)
 	if _, err = ratingClient.PutRating(ctx, &gen.PutRatingRequest{
-		UserId:      userID,
+		UserId:      secondUserID,
 		RecordId:    m.Id,
 		RecordType:  recordTypeMovie,
 		RatingValue: secondRating,
-		Token:       token,
+		Token:       secondToken,
 	}); err != nil {
 		log.Fatal("put rating", zap.Error(err))
 	}
@@ -212,6 +228,121 @@ func main() {
 		log.Fatal("get movie details after update mismatch", zap.String("diff", diff))
 	}
 
+	log.Info("Uploading and downloading a file via movie service")
+
+	uploadStream, err := movieClient.UploadFile(ctx)
+	if err != nil {
+		log.Fatal("upload file", zap.Error(err))
+	}
+	if err := uploadStream.Send(&gen.UploadRequest{
+		Filename:  "poster.txt",
+		Chunk:     []byte("hello, world"),
+		MovieId:   m.Id,
+		AssetKind: "poster",
+		Token:     token,
+	}); err != nil {
+		log.Fatal("upload file", zap.Error(err))
+	}
+	uploadResp, err := uploadStream.CloseAndRecv()
+	if err != nil {
+		log.Fatal("upload file", zap.Error(err))
+	}
+	if want := m.Id + "/poster/poster.txt"; uploadResp.Filename != want {
+		log.Fatal("uploaded file name mismatch", zap.String("got", uploadResp.Filename), zap.String("want", want))
+	}
+
+	uploadStream, err = movieClient.UploadFile(ctx)
+	if err != nil {
+		log.Fatal("retry upload file", zap.Error(err))
+	}
+	if err := uploadStream.Send(&gen.UploadRequest{
+		Filename:  "poster.txt",
+		Chunk:     []byte("hello, world"),
+		MovieId:   m.Id,
+		AssetKind: "poster",
+		Token:     token,
+	}); err != nil {
+		log.Fatal("retry upload file", zap.Error(err))
+	}
+	if _, err := uploadStream.CloseAndRecv(); err != nil {
+		log.Fatal("retry upload file with the same content", zap.Error(err))
+	}
+
+	uploadStream, err = movieClient.UploadFile(ctx)
+	if err != nil {
+		log.Fatal("upload file again", zap.Error(err))
+	}
+	if err := uploadStream.Send(&gen.UploadRequest{
+		Filename:  "poster.txt",
+		Chunk:     []byte("replaced"),
+		MovieId:   m.Id,
+		AssetKind: "poster",
+		Token:     token,
+	}); err != nil {
+		log.Fatal("upload file again", zap.Error(err))
+	}
+	if _, err := uploadStream.CloseAndRecv(); status.Code(err) != codes.AlreadyExists {
+		log.Fatal("upload file again without overwrite", zap.Error(err))
+	}
+
+	log.Info("Getting movie details with the uploaded asset via movie service")
+
+	getMovieDetailsResp, err = movieClient.GetMovieDetails(ctx, &gen.GetMovieDetailsRequest{
+		MovieId: m.Id,
+	})
+	if err != nil {
+		log.Fatal("get movie details", zap.Error(err))
+	}
+	wantMovieDetails.Metadata.Assets = []*gen.Asset{{
+		Kind:        "poster",
+		Filename:    "poster.txt",
+		Path:        m.Id + "/poster/poster.txt",
+		Size:        int64(len("hello, world")),
+		ContentType: uploadResp.ContentType,
+		Sha256:      uploadResp.Sha256,
+	}}
+	if diff := cmp.Diff(getMovieDetailsResp.MovieDetails, wantMovieDetails, cmpopts.IgnoreUnexported(gen.MovieDetails{}, gen.Metadata{}, gen.Asset{})); diff != "" {
+		log.Fatal("get movie details with asset mismatch", zap.String("diff", diff))
+	}
+
+	// Assets are downloaded by the path returned in the movie details.
+	assetPath := getMovieDetailsResp.MovieDetails.Metadata.Assets[0].Path
+	downloadStream, err := movieClient.DownloadFile(ctx, &gen.DownloadRequest{Filename: assetPath, Offset: 7, Length: 5, Token: token})
+	if err != nil {
+		log.Fatal("download file", zap.Error(err))
+	}
+	var downloaded []byte
+	for {
+		resp, err := downloadStream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal("download file", zap.Error(err))
+		}
+		downloaded = append(downloaded, resp.Chunk...)
+	}
+	checksum := sha256.Sum256(downloaded)
+	if string(downloaded) != "world" {
+		log.Fatal("downloaded file mismatch", zap.ByteString("got", downloaded))
+	}
+	if got := downloadStream.Trailer().Get("sha256"); len(got) != 1 || got[0] != hex.EncodeToString(checksum[:]) {
+		log.Fatal("downloaded file checksum mismatch", zap.Strings("got", got))
+	}
+
+	unauthenticatedStream, err := movieClient.DownloadFile(ctx, &gen.DownloadRequest{Filename: assetPath})
+	if err == nil {
+		_, err = unauthenticatedStream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		log.Fatal("download file without token", zap.Error(err))
+	}
+
+	log.Info("Updating a movie with a poster without a token via movie service")
+
+	if _, err := movieClient.UpdateMovie(ctx, &gen.UpdateMovieRequest{Metadata: m, Poster: "missing.txt"}); status.Code(err) != codes.Unauthenticated {
+		log.Fatal("update movie without token", zap.Error(err))
+	}
+
 	log.Info("Integration test execution successful")
 }
 